@@ -12,6 +12,7 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/k8s"
 	"github.com/hazelcast/platform-operator-agent/internal/logger"
 )
 
@@ -111,11 +112,15 @@ func executeDownloadCommands(ctx context.Context, d *Download, f *flag.FlagSet,
 			cmd := cmd
 			g.Go(func() error {
 				log.Info("Download bundle for " + cmd.Destination)
-				return bucket.DownloadBundle(ctx, bucket.BundleReq{
+				err := bucket.DownloadBundle(ctx, bucket.BundleReq{
 					URL:        cmd.BucketURI,
 					SecretName: cmd.SecretName,
 					DestDir:    cmd.Destination,
 				})
+				if err != nil {
+					k8s.NewEventRecorder().Warning(ctx, k8s.ReasonUserCodeDownloadFailed, fmt.Sprintf("Failed to download the bundle from %s: %v", cmd.BucketURI, err))
+				}
+				return err
 			})
 		}
 		return g.Wait()
@@ -127,6 +132,17 @@ func executeRestoreCommands(ctx context.Context, r *Restore, f *flag.FlagSet, ar
 	if r == nil {
 		return nil
 	}
+	if r.DryRun {
+		if r.Bucket != nil {
+			r.Bucket.DryRun = true
+		}
+		if r.PVC != nil {
+			r.PVC.DryRun = true
+		}
+		if r.URL != nil {
+			r.URL.DryRun = true
+		}
+	}
 	if r.Bucket != nil {
 		if s := r.Bucket.Execute(ctx, f, args); s != subcommands.ExitSuccess {
 			return fmt.Errorf("error executing bucket restore command")
@@ -137,5 +153,10 @@ func executeRestoreCommands(ctx context.Context, r *Restore, f *flag.FlagSet, ar
 			return fmt.Errorf("error executing PVC restore command")
 		}
 	}
+	if r.URL != nil {
+		if s := r.URL.Execute(ctx, f, args); s != subcommands.ExitSuccess {
+			return fmt.Errorf("error executing URL restore command")
+		}
+	}
 	return nil
 }
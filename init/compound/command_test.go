@@ -3,6 +3,7 @@ package compound
 import (
 	"archive/zip"
 	"context"
+	"encoding/pem"
 	"flag"
 	"net/http"
 	"net/http/httptest"
@@ -129,3 +130,240 @@ func Test_Execute_URLCommands(t *testing.T) {
 	_, err = os.Stat(path.Join(tempDir, jarName))
 	require.Nil(t, err)
 }
+
+func Test_Execute_URLCommands_CAFile(t *testing.T) {
+	tempDir := t.TempDir()
+
+	jarName := "my-jar.jar"
+	filesPath := path.Join(tempDir, "files")
+	err := fileutil.CreateFiles(filesPath, []fileutil.File{{Name: jarName, IsDir: false}}, true)
+	require.Nil(t, err)
+
+	testServer := httptest.NewTLSServer(http.FileServer(http.Dir(filesPath)))
+	defer testServer.Close()
+	caFile := path.Join(tempDir, "ca.crt")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: testServer.Certificate().Raw})
+	require.Nil(t, os.WriteFile(caFile, ca, 0600))
+
+	configFile, err := os.CreateTemp(tempDir, "config.yaml")
+	require.Nil(t, err)
+
+	cfg := &ConfigWrapper{
+		InitContainer: &Config{
+			Download: &Download{
+				URLs: []downloadurl.Cmd{
+					{
+						Destination: tempDir,
+						URLs:        testServer.URL + "/" + jarName,
+						CAFile:      caFile,
+					},
+				},
+			},
+		},
+	}
+
+	cfgData, err := yaml.Marshal(cfg)
+	require.Nil(t, err)
+	require.Contains(t, string(cfgData), "caFile: "+caFile)
+	require.Nil(t, os.WriteFile(configFile.Name(), cfgData, os.FileMode(0755)))
+
+	cmd := Cmd{ConfigFileLocation: configFile.Name()}
+	exStatus := cmd.Execute(context.TODO(), &flag.FlagSet{})
+
+	require.Equal(t, subcommands.ExitSuccess, exStatus)
+	_, err = os.Stat(path.Join(tempDir, jarName))
+	require.Nil(t, err)
+}
+
+func Test_Execute_URLCommands_DefaultRetries(t *testing.T) {
+	tempDir := t.TempDir()
+
+	jarName := "my-jar.jar"
+	var requests int
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		if requests < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("content"))
+	}))
+	defer testServer.Close()
+
+	configFile, err := os.CreateTemp(tempDir, "config.yaml")
+	require.Nil(t, err)
+
+	// the retries are not set in the config, the defaults apply
+	cfg := &ConfigWrapper{
+		InitContainer: &Config{
+			Download: &Download{
+				URLs: []downloadurl.Cmd{
+					{
+						Destination: tempDir,
+						URLs:        testServer.URL + "/" + jarName,
+					},
+				},
+			},
+		},
+	}
+
+	cfgData, err := yaml.Marshal(cfg)
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(configFile.Name(), cfgData, os.FileMode(0755)))
+
+	cmd := Cmd{ConfigFileLocation: configFile.Name()}
+	exStatus := cmd.Execute(context.TODO(), &flag.FlagSet{})
+
+	require.Equal(t, subcommands.ExitSuccess, exStatus)
+	require.Equal(t, 3, requests)
+	_, err = os.Stat(path.Join(tempDir, jarName))
+	require.Nil(t, err)
+}
+
+func Test_Execute_URLCommands_SyncDeleted(t *testing.T) {
+	tempDir := t.TempDir()
+	dst := path.Join(tempDir, "dst")
+	require.Nil(t, os.MkdirAll(dst, 0755))
+
+	filesPath := path.Join(tempDir, "files")
+	err := fileutil.CreateFiles(filesPath, []fileutil.File{{Name: "a.jar"}, {Name: "b.jar"}}, true)
+	require.Nil(t, err)
+	testServer := httptest.NewServer(http.FileServer(http.Dir(filesPath)))
+	defer testServer.Close()
+
+	configFile, err := os.CreateTemp(tempDir, "config.yaml")
+	require.Nil(t, err)
+
+	cfg := &ConfigWrapper{
+		InitContainer: &Config{
+			Download: &Download{
+				URLs: []downloadurl.Cmd{
+					{
+						Destination: dst,
+						URLs:        testServer.URL + "/a.jar," + testServer.URL + "/b.jar",
+						Sync:        true,
+					},
+				},
+			},
+		},
+	}
+
+	cfgData, err := yaml.Marshal(cfg)
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(configFile.Name(), cfgData, os.FileMode(0755)))
+
+	cmd := Cmd{ConfigFileLocation: configFile.Name()}
+	require.Equal(t, subcommands.ExitSuccess, cmd.Execute(context.TODO(), &flag.FlagSet{}))
+	_, err = os.Stat(path.Join(dst, "b.jar"))
+	require.Nil(t, err)
+
+	// the file deleted from the server is removed, the sync does not fail
+	require.Nil(t, os.Remove(path.Join(filesPath, "b.jar")))
+	require.Equal(t, subcommands.ExitSuccess, cmd.Execute(context.TODO(), &flag.FlagSet{}))
+	_, err = os.Stat(path.Join(dst, "a.jar"))
+	require.Nil(t, err)
+	_, err = os.Stat(path.Join(dst, "b.jar"))
+	require.True(t, os.IsNotExist(err))
+
+	state, err := fileutil.LoadSyncState(path.Join(dst, ".file_download_url.state"))
+	require.Nil(t, err)
+	require.Len(t, state, 1)
+}
+
+func Test_Execute_DownloadCommands_Lock(t *testing.T) {
+	tempDir := t.TempDir()
+	dst := path.Join(tempDir, "dst")
+	require.Nil(t, os.MkdirAll(dst, 0755))
+
+	bucketPath := path.Join(tempDir, "bucket")
+	err := fileutil.CreateFiles(bucketPath, []fileutil.File{{Name: "bucket.jar"}}, true)
+	require.Nil(t, err)
+	var requests int
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		_, _ = w.Write([]byte("content"))
+	}))
+	defer testServer.Close()
+
+	configFile, err := os.CreateTemp(tempDir, "config.yaml")
+	require.Nil(t, err)
+
+	cfg := &ConfigWrapper{
+		InitContainer: &Config{
+			Download: &Download{
+				Buckets: []downloadbucket.Cmd{
+					{
+						Destination: dst,
+						BucketURI:   "file://" + bucketPath,
+					},
+				},
+				URLs: []downloadurl.Cmd{
+					{
+						Destination: dst,
+						URLs:        testServer.URL + "/url.jar",
+					},
+				},
+			},
+		},
+	}
+
+	cfgData, err := yaml.Marshal(cfg)
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(configFile.Name(), cfgData, os.FileMode(0755)))
+
+	cmd := Cmd{ConfigFileLocation: configFile.Name()}
+	require.Equal(t, subcommands.ExitSuccess, cmd.Execute(context.TODO(), &flag.FlagSet{}))
+	require.Equal(t, 1, requests)
+
+	// the lock files skip the downloads of the next run
+	require.Nil(t, os.Remove(path.Join(dst, "bucket.jar")))
+	require.Equal(t, subcommands.ExitSuccess, cmd.Execute(context.TODO(), &flag.FlagSet{}))
+	require.Equal(t, 1, requests)
+	require.NoFileExists(t, path.Join(dst, "bucket.jar"))
+}
+
+func Test_Execute_URLCommands_SyncRenamed(t *testing.T) {
+	tempDir := t.TempDir()
+	dst := path.Join(tempDir, "dst")
+	require.Nil(t, os.MkdirAll(dst, 0755))
+
+	version := "1.0"
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="lib-`+version+`.jar"`)
+		w.Header().Set("ETag", `"`+version+`"`)
+		_, _ = w.Write([]byte(version))
+	}))
+	defer testServer.Close()
+
+	configFile, err := os.CreateTemp(tempDir, "config.yaml")
+	require.Nil(t, err)
+
+	cfg := &ConfigWrapper{
+		InitContainer: &Config{
+			Download: &Download{
+				URLs: []downloadurl.Cmd{
+					{
+						Destination: dst,
+						URLs:        testServer.URL + "/latest",
+						Sync:        true,
+					},
+				},
+			},
+		},
+	}
+
+	cfgData, err := yaml.Marshal(cfg)
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(configFile.Name(), cfgData, os.FileMode(0755)))
+
+	cmd := Cmd{ConfigFileLocation: configFile.Name()}
+	require.Equal(t, subcommands.ExitSuccess, cmd.Execute(context.TODO(), &flag.FlagSet{}))
+	require.FileExists(t, path.Join(dst, "lib-1.0.jar"))
+
+	// the file of the previous name is removed
+	version = "2.0"
+	require.Equal(t, subcommands.ExitSuccess, cmd.Execute(context.TODO(), &flag.FlagSet{}))
+	require.FileExists(t, path.Join(dst, "lib-2.0.jar"))
+	require.NoFileExists(t, path.Join(dst, "lib-1.0.jar"))
+}
@@ -28,4 +28,7 @@ type Bundle struct {
 type Restore struct {
 	Bucket *restore.BucketToPVCCmd `yaml:"bucket,omitempty"`
 	PVC    *restore.LocalInPVCCmd  `yaml:"pvc,omitempty"`
+	URL    *restore.URLToPVCCmd    `yaml:"url,omitempty"`
+	// DryRun enables the dry run of all restore commands
+	DryRun bool `yaml:"dryRun,omitempty"`
 }
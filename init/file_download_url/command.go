@@ -2,27 +2,59 @@ package downloadurl
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/google/subcommands"
 	"github.com/kelseyhightower/envconfig"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/hazelcast/platform-operator-agent/internal/bucket"
 	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/k8s"
 	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/uri"
+	"github.com/hazelcast/platform-operator-agent/internal/verify"
 )
 
-const urlFileLock = ".file_download_url"
+const (
+	urlFileLock  = ".file_download_url"
+	urlSyncState = ".file_download_url.state"
+)
 
 var log = logger.New().Named("file_download_url")
 
 type Cmd struct {
 	Destination string `envconfig:"FDU_DESTINATION" yaml:"destination"`
 	URLs        string `envconfig:"FDU_URLS" yaml:"urls"`
+	// SecretName is the secret with the basic auth credentials, the bearer token or the headers of the requests
+	SecretName string `envconfig:"FDU_SECRET_NAME" yaml:"secretName"`
+	// TLSSecretName is the secret with the CA bundle and the client certificate, alternatively to the mounted files
+	TLSSecretName string `envconfig:"FDU_TLS_SECRET_NAME" yaml:"tlsSecretName"`
+	CAFile        string `envconfig:"FDU_CA_FILE" yaml:"caFile"`
+	CertFile      string `envconfig:"FDU_CERT_FILE" yaml:"certFile"`
+	KeyFile       string `envconfig:"FDU_KEY_FILE" yaml:"keyFile"`
+	// SHA256 are the expected SHA-256 digests of the files
+	SHA256 []string `envconfig:"FDU_SHA256" yaml:"sha256"`
+	// ChecksumManifest is the URL of a checksum manifest in sha256sum format
+	ChecksumManifest string `envconfig:"FDU_CHECKSUM_MANIFEST" yaml:"checksumManifest"`
+	// ChecksumFiles requires a <url>.sha256 checksum file for each URL
+	ChecksumFiles bool `envconfig:"FDU_CHECKSUM_FILES" yaml:"checksumFiles"`
+	// SignatureSecretName is the secret with the public key verifying the <url>.sig signature of each file
+	SignatureSecretName string `envconfig:"FDU_SIGNATURE_SECRET_NAME" yaml:"signatureSecretName"`
+	// Timeout limits each download including the retries
+	Timeout        time.Duration `envconfig:"FDU_TIMEOUT" yaml:"timeout"`
+	ConnectTimeout time.Duration `envconfig:"FDU_CONNECT_TIMEOUT" yaml:"connectTimeout"`
+	Retries        int           `envconfig:"FDU_RETRIES" yaml:"retries"`
+	MaxSize        int64         `envconfig:"FDU_MAX_SIZE" yaml:"maxSize"`
+	// Sync downloads only the changed files on every run and removes the files of the URLs which are not configured anymore or were deleted from the server
+	Sync bool `envconfig:"FDU_SYNC" yaml:"sync"`
 }
 
 func (*Cmd) Name() string     { return "file-download-url" }
@@ -33,6 +65,75 @@ func (r *Cmd) SetFlags(f *flag.FlagSet) {
 	// We ignore error because this is just a default value
 	f.StringVar(&r.URLs, "urls", "", "comma separated urls")
 	f.StringVar(&r.Destination, "dst", "", "dst filesystem path")
+	f.StringVar(&r.SecretName, "secret-name", "", "secret name for the credentials of the URLs")
+	f.StringVar(&r.TLSSecretName, "tls-secret-name", "", "secret name for the CA bundle and the client certificate")
+	f.StringVar(&r.CAFile, "ca-file", "", "path of the CA bundle trusted in addition to the system roots")
+	f.StringVar(&r.CertFile, "cert-file", "", "path of the client certificate")
+	f.StringVar(&r.KeyFile, "key-file", "", "path of the client key")
+	f.Func("sha256", "comma separated expected SHA-256 digests of the files", func(v string) error {
+		r.SHA256 = append(r.SHA256, strings.Split(v, ",")...)
+		return nil
+	})
+	f.StringVar(&r.ChecksumManifest, "checksum-manifest", "", "URL of a checksum manifest in sha256sum format")
+	f.BoolVar(&r.ChecksumFiles, "checksum-files", false, "require a <url>.sha256 checksum file for each URL")
+	f.StringVar(&r.SignatureSecretName, "signature-secret-name", "", "secret name with the public key verifying the <url>.sig signatures")
+	f.DurationVar(&r.Timeout, "timeout", fileutil.DefaultHTTPOptions.Timeout, "timeout of each download including the retries, unlimited if negative")
+	f.DurationVar(&r.ConnectTimeout, "connect-timeout", fileutil.DefaultHTTPOptions.ConnectTimeout, "timeout of establishing a connection")
+	f.IntVar(&r.Retries, "retries", fileutil.DefaultHTTPOptions.Retries, "number of retries on network errors and 5xx responses, none if negative")
+	f.Int64Var(&r.MaxSize, "max-size", 0, "maximum size of each downloaded file in bytes, unlimited if 0")
+	f.BoolVar(&r.Sync, "sync", false, "download only the changed files instead of skipping the download if the lock file exists, files deleted from the server are removed")
+}
+
+func (r *Cmd) verifyOptions(ctx context.Context) (verify.Options, error) {
+	opts := verify.Options{SHA256: r.SHA256, Manifest: r.ChecksumManifest, ChecksumFiles: r.ChecksumFiles}
+	if r.SignatureSecretName == "" {
+		return opts, nil
+	}
+	secret, err := bucket.SecretData(ctx, r.SignatureSecretName)
+	if err != nil {
+		return verify.Options{}, err
+	}
+	opts.PublicKey, err = verify.PublicKeyFromSecret(secret)
+	return opts, err
+}
+
+func (r *Cmd) httpClient(ctx context.Context) (*fileutil.HTTPClient, error) {
+	opts := fileutil.HTTPOptions{
+		ConnectTimeout: r.ConnectTimeout,
+		Timeout:        r.Timeout,
+		Retries:        r.Retries,
+		MaxSize:        r.MaxSize,
+	}
+	if r.SecretName != "" {
+		secret, err := bucket.SecretData(ctx, r.SecretName)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Header, err = fileutil.HeaderFromSecret(secret); err != nil {
+			return nil, err
+		}
+	}
+
+	files := fileutil.TLSFiles{CA: r.CAFile, Cert: r.CertFile, Key: r.KeyFile}
+	var tlsData map[string][]byte
+	var err error
+	switch {
+	case r.TLSSecretName != "" && files.IsSet():
+		return nil, fmt.Errorf("the TLS secret and the TLS files are mutually exclusive")
+	case r.TLSSecretName != "":
+		tlsData, err = bucket.SecretData(ctx, r.TLSSecretName)
+	case files.IsSet():
+		tlsData, err = files.Read()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tlsData != nil {
+		if opts.TLSConfig, err = fileutil.TLSConfigFromSecret(tlsData); err != nil {
+			return nil, err
+		}
+	}
+	return fileutil.NewHTTPClient(opts), nil
 }
 
 func (r *Cmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -43,18 +144,48 @@ func (r *Cmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) su
 	}
 
 	lock := filepath.Join(r.Destination, urlFileLock)
-	if _, err := os.Stat(lock); err == nil || os.IsExist(err) {
+	if _, err := os.Stat(lock); !r.Sync && (err == nil || os.IsExist(err)) {
 		// If usercodeLock lock exists exit
-		log.Error("lock file exists, exiting: " + err.Error())
+		log.Info("lock file exists, exiting", zap.String("lock", lock))
 		return subcommands.ExitSuccess
 	}
 
 	urls := strings.Split(r.URLs, ",")
 
+	opts, err := r.verifyOptions(ctx)
+	if err != nil {
+		log.Error("verification config error: " + err.Error())
+		return subcommands.ExitFailure
+	}
+	client, err := r.httpClient(ctx)
+	if err != nil {
+		log.Error("credentials error: " + err.Error())
+		return subcommands.ExitFailure
+	}
+	v, err := verify.New(ctx, opts, client.Fetch)
+	if err != nil {
+		log.Error("verification config error: " + err.Error())
+		k8s.NewEventRecorder().Warning(ctx, k8s.ReasonUserCodeDownloadFailed, fmt.Sprintf("Failed to download from %s: %v", redactURLs(urls), err))
+		return subcommands.ExitFailure
+	}
+
+	if r.Sync {
+		log.Info("starting sync", zap.String("destination", r.Destination))
+		res, err := syncFiles(ctx, client, urls, r.Destination, v, filepath.Join(r.Destination, urlSyncState))
+		if err != nil {
+			log.Error("sync error: " + err.Error())
+			k8s.NewEventRecorder().Warning(ctx, k8s.ReasonUserCodeDownloadFailed, fmt.Sprintf("Failed to download from %s: %v", redactURLs(urls), err))
+			return subcommands.ExitFailure
+		}
+		log.Info("sync successful", zap.Int("downloaded", res.Downloaded), zap.Int("unchanged", res.Unchanged), zap.Int("removed", res.Removed))
+		return subcommands.ExitSuccess
+	}
+
 	// run download process
 	log.Info("starting download", zap.String("destination", r.Destination))
-	if err := downloadFiles(ctx, urls, r.Destination); err != nil {
+	if err := downloadFiles(ctx, client, urls, r.Destination, v); err != nil {
 		log.Error("download error: " + err.Error())
+		k8s.NewEventRecorder().Warning(ctx, k8s.ReasonUserCodeDownloadFailed, fmt.Sprintf("Failed to download from %s: %v", redactURLs(urls), err))
 		return subcommands.ExitFailure
 	}
 
@@ -66,12 +197,21 @@ func (r *Cmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) su
 	return subcommands.ExitSuccess
 }
 
-func downloadFiles(ctx context.Context, srcURLs []string, dst string) error {
+// redactURLs returns the URLs without their queries and user info, for the events
+func redactURLs(urls []string) string {
+	redacted := make([]string, len(urls))
+	for i, u := range urls {
+		redacted[i] = uri.Redact(u)
+	}
+	return strings.Join(redacted, ",")
+}
+
+func downloadFiles(ctx context.Context, c *fileutil.HTTPClient, srcURLs []string, dst string, v *verify.Verifier) error {
 	g, groupCtx := errgroup.WithContext(ctx)
 	for _, url := range srcURLs {
 		url := url
 		g.Go(func() error {
-			return fileutil.DownloadFileFromURL(groupCtx, url, dst)
+			return fileutil.DownloadFileFromURL(groupCtx, c, url, dst, v)
 		})
 	}
 
@@ -81,3 +221,53 @@ func downloadFiles(ctx context.Context, srcURLs []string, dst string) error {
 
 	return nil
 }
+
+// syncFiles downloads the files of the URLs, which changed since the last sync, and removes the files of the URLs
+// which are not in srcURLs anymore
+func syncFiles(ctx context.Context, c *fileutil.HTTPClient, srcURLs []string, dst string, v *verify.Verifier, stateFile string) (fileutil.SyncResult, error) {
+	var res fileutil.SyncResult
+	state, err := fileutil.LoadSyncState(stateFile)
+	if err != nil {
+		return res, fmt.Errorf("could not read the sync state: %w", err)
+	}
+
+	entries := make([]fileutil.SyncEntry, len(srcURLs))
+	downloaded := make([]bool, len(srcURLs))
+	deleted := make([]bool, len(srcURLs))
+	g, groupCtx := errgroup.WithContext(ctx)
+	for i, url := range srcURLs {
+		i, url := i, url
+		g.Go(func() (err error) {
+			entries[i], downloaded[i], err = fileutil.SyncFileFromURL(groupCtx, c, url, dst, state[url], v)
+			if errors.Is(err, fileutil.ErrDeleted) {
+				// the file is removed with its state entry below
+				log.Warn("file was deleted from the server: "+err.Error(), zap.String("url", uri.Redact(url)))
+				deleted[i] = true
+				return nil
+			}
+			return err
+		})
+	}
+	if err = g.Wait(); err != nil {
+		return res, err
+	}
+
+	next := make(fileutil.SyncState, len(srcURLs))
+	for i, url := range srcURLs {
+		if deleted[i] {
+			continue
+		}
+		next[url] = entries[i]
+		if downloaded[i] {
+			res.Downloaded++
+		} else {
+			res.Unchanged++
+		}
+	}
+	removed, err := state.RemoveDeleted(dst, next)
+	res.Removed = len(removed)
+	if err != nil {
+		return res, err
+	}
+	return res, next.Save(stateFile)
+}
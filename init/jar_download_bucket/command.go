@@ -3,19 +3,26 @@ package downloadbucket
 import (
 	"context"
 	"flag"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/google/subcommands"
 	"github.com/kelseyhightower/envconfig"
 	"go.uber.org/zap"
 
 	"github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/k8s"
 	"github.com/hazelcast/platform-operator-agent/internal/logger"
 	"github.com/hazelcast/platform-operator-agent/internal/uri"
+	"github.com/hazelcast/platform-operator-agent/internal/verify"
 )
 
-const bucketLock = ".download_bucket"
+const (
+	bucketLock      = ".download_bucket"
+	bucketSyncState = ".download_bucket.state"
+)
 
 var log = logger.New().Named("download_bucket")
 
@@ -23,6 +30,21 @@ type Cmd struct {
 	Destination string `envconfig:"JDB_DESTINATION" yaml:"destination"`
 	SecretName  string `envconfig:"JDB_SECRET_NAME" yaml:"secretName"`
 	BucketURI   string `envconfig:"JDB_BUCKET_URI" yaml:"bucketURI"`
+	// Recursive downloads the files in sub-folders too, keeping their relative directories
+	Recursive bool     `envconfig:"JDB_RECURSIVE" yaml:"recursive"`
+	Include   []string `envconfig:"JDB_INCLUDE" yaml:"include"`
+	Exclude   []string `envconfig:"JDB_EXCLUDE" yaml:"exclude"`
+	MaxSize   int64    `envconfig:"JDB_MAX_SIZE" yaml:"maxSize"`
+	// SHA256 are the expected SHA-256 digests of the files
+	SHA256 []string `envconfig:"JDB_SHA256" yaml:"sha256"`
+	// ChecksumManifest is the key of a checksum manifest in sha256sum format in the bucket
+	ChecksumManifest string `envconfig:"JDB_CHECKSUM_MANIFEST" yaml:"checksumManifest"`
+	// ChecksumFiles requires a <key>.sha256 checksum file in the bucket for each file
+	ChecksumFiles bool `envconfig:"JDB_CHECKSUM_FILES" yaml:"checksumFiles"`
+	// SignatureSecretName is the secret with the public key verifying the <key>.sig signature of each file
+	SignatureSecretName string `envconfig:"JDB_SIGNATURE_SECRET_NAME" yaml:"signatureSecretName"`
+	// Sync downloads only the changed objects on every run and removes the files of the objects deleted from the bucket
+	Sync bool `envconfig:"JDB_SYNC" yaml:"sync"`
 }
 
 func (*Cmd) Name() string     { return "jar-download-bucket" }
@@ -34,6 +56,40 @@ func (r *Cmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&r.BucketURI, "src", "", "src bucket path")
 	f.StringVar(&r.Destination, "dst", "", "dst filesystem path")
 	f.StringVar(&r.SecretName, "secret-name", "", "secret name for the bucket credentials")
+	f.BoolVar(&r.Recursive, "recursive", false, "download the files in sub-folders too")
+	f.Func("include", "comma separated glob patterns of the downloaded files, e.g. **/*.jar", patterns(&r.Include))
+	f.Func("exclude", "comma separated glob patterns of the skipped files", patterns(&r.Exclude))
+	f.Int64Var(&r.MaxSize, "max-size", 0, "maximum total size of the downloaded files in bytes, unlimited if 0")
+	f.Func("sha256", "comma separated expected SHA-256 digests of the files", patterns(&r.SHA256))
+	f.StringVar(&r.ChecksumManifest, "checksum-manifest", "", "key of a checksum manifest in sha256sum format in the bucket")
+	f.BoolVar(&r.ChecksumFiles, "checksum-files", false, "require a <key>.sha256 checksum file for each file")
+	f.StringVar(&r.SignatureSecretName, "signature-secret-name", "", "secret name with the public key verifying the <key>.sig signatures")
+	f.BoolVar(&r.Sync, "sync", false, "download only the changed files instead of skipping the download if the lock file exists")
+}
+
+func (r *Cmd) verifyOptions(ctx context.Context) (verify.Options, error) {
+	opts := verify.Options{SHA256: r.SHA256, Manifest: r.ChecksumManifest, ChecksumFiles: r.ChecksumFiles}
+	if r.SignatureSecretName == "" {
+		return opts, nil
+	}
+	secret, err := bucket.SecretData(ctx, r.SignatureSecretName)
+	if err != nil {
+		return verify.Options{}, err
+	}
+	opts.PublicKey, err = verify.PublicKeyFromSecret(secret)
+	return opts, err
+}
+
+// patterns appends the comma separated patterns of the flag value to the list
+func patterns(list *[]string) func(string) error {
+	return func(v string) error {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				*list = append(*list, p)
+			}
+		}
+		return nil
+	}
 }
 
 func (r *Cmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -46,9 +102,9 @@ func (r *Cmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) su
 	}
 
 	lock := filepath.Join(r.Destination, bucketLock)
-	if _, err := os.Stat(lock); err == nil || os.IsExist(err) {
+	if _, err := os.Stat(lock); !r.Sync && (err == nil || os.IsExist(err)) {
 		// If usercodeLock lock exists exit
-		log.Error("lock file exists, exiting: " + err.Error())
+		log.Info("lock file exists, exiting", zap.String("lock", lock))
 		return subcommands.ExitSuccess
 	}
 
@@ -61,8 +117,31 @@ func (r *Cmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) su
 
 	// run download process
 	log.Info("starting download", zap.String("destination", r.Destination))
-	if err = bucket.DownloadFiles(ctx, bucketURI, r.Destination, r.SecretName); err != nil {
+	verifyOpts, err := r.verifyOptions(ctx)
+	if err != nil {
+		log.Error("verification config error: " + err.Error())
+		return subcommands.ExitFailure
+	}
+	opts := bucket.DownloadOptions{
+		Recursive:    r.Recursive,
+		Include:      r.Include,
+		Exclude:      r.Exclude,
+		MaxTotalSize: r.MaxSize,
+		Verify:       verifyOpts,
+	}
+	if r.Sync {
+		res, err := bucket.SyncFiles(ctx, bucketURI, r.Destination, r.SecretName, opts, filepath.Join(r.Destination, bucketSyncState))
+		if err != nil {
+			log.Error("sync error: " + err.Error())
+			k8s.NewEventRecorder().Warning(ctx, k8s.ReasonUserCodeDownloadFailed, fmt.Sprintf("Failed to download from %s: %v", bucketURI, err))
+			return subcommands.ExitFailure
+		}
+		log.Info("sync successful", zap.Int("downloaded", res.Downloaded), zap.Int("unchanged", res.Unchanged), zap.Int("removed", res.Removed))
+		return subcommands.ExitSuccess
+	}
+	if err = bucket.DownloadFiles(ctx, bucketURI, r.Destination, r.SecretName, opts); err != nil {
 		log.Error("download error: " + err.Error())
+		k8s.NewEventRecorder().Warning(ctx, k8s.ReasonUserCodeDownloadFailed, fmt.Sprintf("Failed to download from %s: %v", bucketURI, err))
 		return subcommands.ExitFailure
 	}
 
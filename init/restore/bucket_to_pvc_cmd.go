@@ -5,7 +5,6 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"path"
 	"path/filepath"
 
 	"github.com/google/subcommands"
@@ -13,7 +12,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/hazelcast/platform-operator-agent/internal/bucket"
-	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/k8s"
 	"github.com/hazelcast/platform-operator-agent/internal/logger"
 	"github.com/hazelcast/platform-operator-agent/internal/uri"
 )
@@ -25,6 +24,11 @@ type BucketToPVCCmd struct {
 	Destination string `envconfig:"RESTORE_DESTINATION" yaml:"destination"`
 	SecretName  string `envconfig:"RESTORE_SECRET_NAME" yaml:"secretName"`
 	RestoreID   string `envconfig:"RESTORE_ID" yaml:"restoreID"`
+	MaxSize     int64  `envconfig:"RESTORE_MAX_SIZE" yaml:"maxSize"`
+	BackupSet   string `envconfig:"RESTORE_BACKUP_SET" yaml:"backupSet"`
+	Timestamp   string `envconfig:"RESTORE_TIMESTAMP" yaml:"timestamp"`
+	DryRun      bool   `envconfig:"RESTORE_DRY_RUN" yaml:"dryRun"`
+	Ordinal     string `envconfig:"RESTORE_ORDINAL" yaml:"ordinal"`
 }
 
 func (*BucketToPVCCmd) Name() string     { return "restore_pvc" }
@@ -35,6 +39,11 @@ func (r *BucketToPVCCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&r.Bucket, "src", "", "src bucket path")
 	f.StringVar(&r.Destination, "dst", "/data/persistence/backup", "dst filesystem path")
 	f.StringVar(&r.SecretName, "secret-name", "", "secret name for the bucket credentials")
+	f.Int64Var(&r.MaxSize, "max-size", defaultMaxExtractSize, "maximum extracted size of the backup in bytes")
+	f.StringVar(&r.BackupSet, "backup-set", "", "exact name of the backup set to restore, e.g. 2006-01-02-15-04-05")
+	f.StringVar(&r.Timestamp, "timestamp", "", "restore the newest backup set at or before the timestamp, in RFC 3339 or 2006-01-02-15-04-05 (UTC) format")
+	f.BoolVar(&r.DryRun, "dry-run", false, "log what the restore would do without changing the destination")
+	f.StringVar(&r.Ordinal, "ordinal", "", "member index, resolved from the pod-index label or the hostname if empty")
 }
 
 func (r *BucketToPVCCmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -46,17 +55,16 @@ func (r *BucketToPVCCmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...inte
 		return subcommands.ExitFailure
 	}
 
-	hostname := os.Getenv("HOSTNAME")
-	if !hostnameRE.MatchString(hostname) {
-		log.Error("invalid hostname, need to conform to statefulset naming scheme")
-		return subcommands.ExitFailure
+	var events *k8s.EventRecorder
+	if !r.DryRun {
+		events = k8s.NewEventRecorder()
 	}
 
-	id, err := parseID(hostname)
+	id, err := memberOrdinal(ctx, r.Ordinal, log)
 	if err != nil {
+		log.Error("member ordinal error: " + err.Error())
 		return subcommands.ExitFailure
 	}
-	log.Info("agent id parse successfully", zap.Int("agent id", id))
 
 	bucketURI, err := uri.NormalizeURI(r.Bucket)
 	if err != nil {
@@ -64,18 +72,37 @@ func (r *BucketToPVCCmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...inte
 	}
 	log.Info("bucket uri normalized successfully", zap.String("bucket URI", bucketURI))
 
+	sel, err := newBackupSelector(r.BackupSet, r.Timestamp)
+	if err != nil {
+		log.Error("invalid backup selection: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
 	lock := filepath.Join(r.Destination, lockFileName(r.RestoreID, id))
 
 	if _, err = os.Stat(lock); err == nil || os.IsExist(err) {
 		// If restore lock exists exit
 		log.Info("restore lock exists, exiting")
+		events.Normal(ctx, k8s.ReasonRestoreSkipped, fmt.Sprintf("Restore lock %s exists, skipping the restore", lock))
+		return subcommands.ExitSuccess
+	}
+
+	if r.DryRun {
+		plan, err := planBucketToPvc(ctx, bucketURI, r.Destination, id, r.SecretName, sel)
+		if err != nil {
+			log.Error("dry run error: " + err.Error())
+			return subcommands.ExitFailure
+		}
+		plan.log(log)
 		return subcommands.ExitSuccess
 	}
 
 	// run download process
 	log.Info("Starting download:", zap.Int(r.Destination, id))
-	if err = downloadFromBucketToPvc(ctx, bucketURI, r.Destination, id, r.SecretName); err != nil {
+	key, checksum, err := downloadFromBucketToPvc(ctx, bucketURI, r.Destination, id, r.SecretName, sel, r.MaxSize)
+	if err != nil {
 		log.Error("download error: " + err.Error())
+		events.Warning(ctx, k8s.ReasonRestoreFailed, fmt.Sprintf("Failed to restore member %d from %s: %v", id, bucketURI, err))
 		return subcommands.ExitFailure
 	}
 
@@ -84,57 +111,50 @@ func (r *BucketToPVCCmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...inte
 		return subcommands.ExitFailure
 	}
 
-	if err = os.WriteFile(lock, []byte{}, 0600); err != nil {
+	if err = writeLock(lock, newLockRecord(bucketURI, key, checksum)); err != nil {
 		log.Error("lock file creation error: " + err.Error())
 		return subcommands.ExitFailure
 	}
 
 	log.Info("restore successful")
+	events.Normal(ctx, k8s.ReasonRestoreCompleted, fmt.Sprintf("Restored member %d from %s", id, bucketURI))
 	return subcommands.ExitSuccess
 }
 
-func downloadFromBucketToPvc(ctx context.Context, src, dst string, id int, secretName string) error {
+// downloadFromBucketToPvc restores the member's archive and returns its key and checksum
+func downloadFromBucketToPvc(ctx context.Context, src, dst string, id int, secretName string, sel backupSelector, maxSize int64) (string, string, error) {
 	b, err := bucket.OpenBucket(ctx, src, secretName)
 	if err != nil {
-		return err
+		return "", "", err
 	}
 	defer b.Close()
 
-	// find keys, they are sorted
-	keys, err := find(ctx, b)
+	_, key, err := findMemberArchive(ctx, b, id, sel)
 	if err != nil {
-		return err
-	}
-
-	if id >= len(keys) {
-		return fmt.Errorf("member index %d is greater than number of archived backup files %d", id, len(keys))
+		return "", "", err
 	}
-
-	if _, err = os.Stat(dst); os.IsNotExist(err) {
-		err = os.Mkdir(dst, 0755)
-		if err != nil {
-			return err
-		}
+	uuid, err := archiveUUID(ctx, b, key)
+	if err != nil {
+		return "", "", err
 	}
 
-	// find backup UUIDs, they are sorted
-	hotRestartUUIDs, err := fileutil.FolderUUIDs(dst)
+	// extract next to the existing hot-restart data, which is kept until the new data is complete
+	st, err := newStage(dst)
 	if err != nil {
-		return err
+		return "", "", err
 	}
+	defer st.cleanup()
+	st.uuid = uuid
 
-	// Remove the hot-restart folder at the destination
-	for _, uuid := range hotRestartUUIDs {
-		err = os.RemoveAll(path.Join(dst, uuid.Name()))
-		if err != nil {
-			return err
-		}
+	log.Info("restoring ", zap.String("key", key))
+	checksum, err := saveFromArchive(ctx, bucketSource{b}, key, filepath.Join(dst, spoolDirName), st.dir, maxSize)
+	if err != nil {
+		return "", "", err
 	}
 
-	log.Info("restoring ", zap.String("key", keys[id]))
-	if err = saveFromArchive(ctx, b, keys[id], dst); err != nil {
-		return err
+	if err = st.commit(); err != nil {
+		return "", "", err
 	}
 
-	return b.Close()
+	return key, checksum, b.Close()
 }
@@ -8,9 +8,11 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob"
 	"gocloud.dev/blob/fileblob"
 
 	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/sidecar"
 )
 
 var exampleTarGzFiles = []fileutil.File{
@@ -64,6 +66,18 @@ func TestDownloadFromBucketToPVC(t *testing.T) {
 				"00000000-0000-0000-0000-000000000004",
 			},
 			1, "00000000-0000-0000-0000-000000000004.tar.gz", false},
+		{
+			"member index out of selected backup set",
+			[]string{
+				"2006-01-02-15-04-01/00000000-0000-0000-0000-000000000001.tar.gz",
+				"2006-01-02-15-04-01/00000000-0000-0000-0000-000000000002.tar.gz",
+				"2006-01-02-15-04-02/00000000-0000-0000-0000-000000000001.tar.gz",
+			},
+			[]string{},
+			1,
+			"",
+			true,
+		},
 		{
 			"no uuid folder",
 			[]string{
@@ -113,7 +127,7 @@ func TestDownloadFromBucketToPVC(t *testing.T) {
 
 			// test
 
-			err = downloadFromBucketToPvc(ctx, "file://"+bucketPath, dstPath, tt.id, "")
+			_, _, err = downloadFromBucketToPvc(ctx, "file://"+bucketPath, dstPath, tt.id, "", backupSelector{}, 0)
 			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
 			if err != nil {
 				return
@@ -136,3 +150,79 @@ func TestDownloadFromBucketToPVC(t *testing.T) {
 		})
 	}
 }
+
+func TestDownloadFromBucketToPVC_SelectedSetTooSmall(t *testing.T) {
+	tmpdir := t.TempDir()
+	archiveDir := path.Join(tmpdir, "archive")
+	require.Nil(t, fileutil.CreateFiles(archiveDir, exampleTarGzFiles, true))
+	bucketPath := path.Join(tmpdir, "bucket")
+	for _, key := range []string{
+		"2006-01-02-15-04-01/00000000-0000-0000-0000-000000000001.tar.gz",
+		"2006-01-02-15-04-01/00000000-0000-0000-0000-000000000002.tar.gz",
+		"2006-01-02-15-04-02/00000000-0000-0000-0000-000000000001.tar.gz",
+	} {
+		require.Nil(t, createArchiveFile(archiveDir, strings.TrimSuffix(path.Base(key), ".tar.gz"), path.Join(bucketPath, key)))
+	}
+
+	sel, err := newBackupSelector("2006-01-02-15-04-02", "")
+	require.Nil(t, err)
+	_, _, err = downloadFromBucketToPvc(context.Background(), "file://"+bucketPath, path.Join(tmpdir, "dest"), 1, "", sel, 0)
+	require.EqualError(t, err, "backup set 2006-01-02-15-04-02 has 1 archived backup files, member index 1 needs at least 2")
+
+	sel, err = newBackupSelector("", "2006-01-02T15:04:01Z")
+	require.Nil(t, err)
+	_, _, err = downloadFromBucketToPvc(context.Background(), "file://"+bucketPath, path.Join(tmpdir, "dest"), 1, "", sel, 0)
+	require.Nil(t, err)
+}
+
+func TestDownloadFromBucketToPVC_MemberUUID(t *testing.T) {
+	tests := []struct {
+		name    string
+		uuid    string
+		wantErr string
+	}{
+		{"matching uuid", newUUID, ""},
+		{"no uuid", "", ""},
+		{
+			"other uuid",
+			"00000000-0000-0000-0000-000000000002",
+			"restored hot-restart directory " + newUUID + " does not match the member UUID 00000000-0000-0000-0000-000000000002 of the archive",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set up
+			ctx := context.Background()
+			tmpdir := t.TempDir()
+			archiveDir := path.Join(tmpdir, "archive")
+			require.Nil(t, fileutil.CreateFiles(archiveDir, exampleTarGzFiles, true))
+			archive := path.Join(tmpdir, "member.tar.gz")
+			require.Nil(t, createArchiveFile(archiveDir, newUUID, archive))
+			data, err := os.ReadFile(archive)
+			require.Nil(t, err)
+
+			bucketPath := path.Join(tmpdir, "bucket")
+			require.Nil(t, os.MkdirAll(bucketPath, 0755))
+			b, err := fileblob.OpenBucket(bucketPath, nil)
+			require.Nil(t, err)
+			opts := &blob.WriterOptions{Metadata: map[string]string{sidecar.MemberIDMetadataKey: "0"}}
+			if tt.uuid != "" {
+				opts.Metadata[sidecar.MemberUUIDMetadataKey] = tt.uuid
+			}
+			require.Nil(t, b.WriteAll(ctx, "2006-01-02-15-04-01/"+newUUID+".tar.gz", data, opts))
+			require.Nil(t, b.Close())
+			dst := path.Join(tmpdir, "dest")
+			require.Nil(t, fileutil.CreateFiles(dst, []fileutil.File{{Name: oldUUID, IsDir: true}}, true))
+
+			// Run test
+			_, _, err = downloadFromBucketToPvc(ctx, "file://"+bucketPath, dst, 0, "", backupSelector{}, 0)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				require.Equal(t, []string{oldUUID}, dirNames(t, dst))
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, []string{newUUID}, dirNames(t, dst))
+		})
+	}
+}
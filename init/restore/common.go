@@ -1,7 +1,6 @@
 package restore
 
 import (
-	"archive/tar"
 	"compress/gzip"
 	"context"
 	"errors"
@@ -10,61 +9,61 @@ import (
 	"io/fs"
 	"os"
 	"path"
-	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"go.uber.org/zap"
 	"gocloud.dev/blob"
 
 	"github.com/hazelcast/platform-operator-agent/sidecar"
 )
 
-func saveFromArchive(ctx context.Context, bucket *blob.Bucket, key, target string) error {
-	s, err := bucket.NewReader(ctx, key, nil)
+// saveFromArchive downloads the tar.gz archive with the given key into spoolDir, resuming an interrupted download,
+// verifies its checksums and extracts it below the target directory. Extraction fails on entries escaping the target and if
+// maxSize bytes are exceeded. It returns the SHA-256 checksum of the archive.
+func saveFromArchive(ctx context.Context, src archiveSource, key, spoolDir, target string, maxSize int64) (string, error) {
+	sp := newSpool(src, key, spoolDir)
+	if err := sp.download(ctx); err != nil {
+		return "", err
+	}
+	defer sp.remove()
+
+	s, err := os.Open(sp.path)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer s.Close()
 
 	g, err := gzip.NewReader(s)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer g.Close()
 
-	t := tar.NewReader(g)
-	for {
-		header, err := t.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
-
-		name := filepath.Join(target, header.Name)
-		if err = saveFile(name, header.FileInfo(), t); err != nil {
-			return err
-		}
+	if err = extractArchive(g, target, maxSize); err != nil {
+		return "", fmt.Errorf("could not extract %s: %w", key, err)
 	}
 
-	return s.Close()
+	return "sha256:" + sp.digest, s.Close()
 }
 
-func saveFile(name string, info fs.FileInfo, src io.Reader) error {
-	if info.IsDir() {
-		return os.MkdirAll(name, info.Mode())
-	}
-
-	dst, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+// saveFile writes a regular file with the exact mode, regardless of the umask
+func saveFile(name string, mode fs.FileMode, src io.Reader) error {
+	dst, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
 	if err != nil {
 		return err
 	}
 	defer dst.Close()
 
-	_, err = io.Copy(dst, src)
-	return err
+	if _, err = io.Copy(dst, src); err != nil {
+		return err
+	}
+	if err = dst.Chmod(mode.Perm()); err != nil {
+		return err
+	}
+	return dst.Close()
 }
 
 func cleanupLocks(folder string, id int) error {
@@ -100,9 +99,51 @@ func getLocks(dir string) ([]os.DirEntry, error) {
 	return locks, nil
 }
 
-func find(ctx context.Context, bucket *blob.Bucket) ([]string, error) {
+// backupSetLayout is the time layout of the backup set directory names
+const backupSetLayout = "2006-01-02-15-04-05"
+
+// backupSelector selects the backup set to restore, the latest one if empty
+type backupSelector struct {
+	// name is the exact backup set name
+	name string
+	// before selects the newest backup set at or before the time
+	before time.Time
+}
+
+func newBackupSelector(name, timestamp string) (backupSelector, error) {
+	if name != "" && timestamp != "" {
+		return backupSelector{}, fmt.Errorf("backup set name and timestamp cannot be used together")
+	}
+	sel := backupSelector{name: strings.TrimSuffix(name, "/")}
+	if timestamp == "" {
+		return sel, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		if t, err = time.Parse(backupSetLayout, timestamp); err != nil {
+			return backupSelector{}, fmt.Errorf("invalid timestamp %s, expected RFC 3339 or %s format", timestamp, backupSetLayout)
+		}
+	}
+	sel.before = t
+	return sel, nil
+}
+
+func (s backupSelector) String() string {
+	switch {
+	case s.name != "":
+		return "backup set " + s.name
+	case !s.before.IsZero():
+		return "newest backup set at or before " + s.before.UTC().Format(time.RFC3339)
+	default:
+		return "latest backup set"
+	}
+}
+
+// find returns the selected backup set and its sorted keys. The set is empty if the archives are not in backup set directories.
+func find(ctx context.Context, bucket *blob.Bucket, sel backupSelector) (string, []string, error) {
 	var keys []string
-	var latest string
+	var sets []string
 	iter := bucket.List(nil)
 	for {
 		obj, err := iter.Next(ctx)
@@ -110,7 +151,7 @@ func find(ctx context.Context, bucket *blob.Bucket) ([]string, error) {
 			break
 		}
 		if err != nil {
-			return nil, err
+			return "", nil, err
 		}
 
 		// naive validation, we only want tgz files
@@ -118,23 +159,24 @@ func find(ctx context.Context, bucket *blob.Bucket) ([]string, error) {
 			continue
 		}
 
-		// find the latest directory if key starts with date (is in a directory with backups)
+		// collect backup set directories if key starts with date (is in a directory with backups)
 		if dateRE.MatchString(obj.Key) {
-			dir := filepath.Dir(obj.Key)
-			// lexicographical comparison is good enough
-			if dir > latest {
-				latest = dir
-			}
+			sets = append(sets, strings.TrimSuffix(dateRE.FindString(obj.Key), "/"))
 		}
 
 		keys = append(keys, obj.Key)
 	}
 
-	// this was a directory with backups, filter keys in the latest backup
-	if latest != "" {
+	set, err := selectBackupSet(sets, sel)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// this was a directory with backups, filter keys in the selected backup
+	if set != "" {
 		var l []string
 		for _, k := range keys {
-			if strings.HasPrefix(k, latest) {
+			if strings.HasPrefix(k, set+"/") {
 				l = append(l, k)
 			}
 		}
@@ -142,13 +184,122 @@ func find(ctx context.Context, bucket *blob.Bucket) ([]string, error) {
 	}
 
 	if len(keys) == 0 {
-		return nil, fmt.Errorf("there are no archived backup files in the bucket")
+		return "", nil, fmt.Errorf("there are no archived backup files in the bucket")
 	}
 
 	// to be extra safe we always sort the keys
 	sort.Strings(keys)
 
-	return keys, nil
+	return set, keys, nil
+}
+
+func selectBackupSet(sets []string, sel backupSelector) (string, error) {
+	if len(sets) == 0 {
+		if sel.name != "" || !sel.before.IsZero() {
+			return "", fmt.Errorf("cannot select the %s, there are no backup sets in the bucket", sel)
+		}
+		return "", nil
+	}
+
+	// lexicographical order is the chronological order
+	sort.Sort(sort.Reverse(sort.StringSlice(sets)))
+	for _, set := range sets {
+		switch {
+		case sel.name != "":
+			if set == sel.name {
+				return set, nil
+			}
+		case !sel.before.IsZero():
+			t, err := time.Parse(backupSetLayout, set)
+			if err != nil {
+				return "", fmt.Errorf("invalid backup set name %s: %w", set, err)
+			}
+			if !t.After(sel.before) {
+				return set, nil
+			}
+		default:
+			return set, nil
+		}
+	}
+	return "", fmt.Errorf("could not find the %s in the bucket", sel)
+}
+
+// findMemberArchive returns the selected backup set and the key of the member's archive in it
+func findMemberArchive(ctx context.Context, bucket *blob.Bucket, id int, sel backupSelector) (string, string, error) {
+	// find keys, they are sorted
+	set, keys, err := find(ctx, bucket, sel)
+	if err != nil {
+		return "", "", err
+	}
+	if set != "" {
+		log.Info("selected backup set", zap.String("backup set", set), zap.Stringer("selection", sel), zap.Int("archives", len(keys)))
+	}
+
+	key, err := memberArchive(ctx, bucket, set, keys, id)
+	if err != nil {
+		return "", "", err
+	}
+	return set, key, nil
+}
+
+// memberArchive returns the key of the archive uploaded by the member with the given id.
+// Archives without member metadata, uploaded by older agents, are mapped by their sorted order.
+func memberArchive(ctx context.Context, bucket *blob.Bucket, set string, keys []string, id int) (string, error) {
+	byMember := make(map[int]string, len(keys))
+	var legacy []string
+	for _, key := range keys {
+		attrs, err := bucket.Attributes(ctx, key)
+		if err != nil {
+			return "", err
+		}
+		v, ok := attrs.Metadata[sidecar.MemberIDMetadataKey]
+		if !ok {
+			legacy = append(legacy, key)
+			continue
+		}
+		member, err := strconv.Atoi(v)
+		if err != nil || member < 0 {
+			return "", fmt.Errorf("invalid member id %q in the metadata of %s", v, key)
+		}
+		if other, ok := byMember[member]; ok {
+			return "", fmt.Errorf("archives %s and %s are both uploaded by member %d", other, key, member)
+		}
+		byMember[member] = key
+	}
+
+	if len(byMember) == 0 {
+		if id >= len(keys) {
+			if set != "" {
+				return "", fmt.Errorf("backup set %s has %d archived backup files, member index %d needs at least %d", set, len(keys), id, id+1)
+			}
+			return "", fmt.Errorf("member index %d is greater than number of archived backup files %d", id, len(keys))
+		}
+		return keys[id], nil
+	}
+
+	if len(legacy) > 0 {
+		return "", fmt.Errorf("archives %s have no member metadata unlike the other archives", strings.Join(legacy, ", "))
+	}
+
+	key, ok := byMember[id]
+	if !ok {
+		members := make([]int, 0, len(byMember))
+		for m := range byMember {
+			members = append(members, m)
+		}
+		sort.Ints(members)
+		return "", fmt.Errorf("there is no archive uploaded by member %d, archives are uploaded by members %v", id, members)
+	}
+	return key, nil
+}
+
+// archiveUUID returns the hot-restart UUID in the metadata of the archive, empty for archives uploaded by older agents
+func archiveUUID(ctx context.Context, bucket *blob.Bucket, key string) (string, error) {
+	attrs, err := bucket.Attributes(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	return attrs.Metadata[sidecar.MemberUUIDMetadataKey], nil
 }
 
 var errParseID = errors.New("couldn't parse statefulset hostname")
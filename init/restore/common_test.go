@@ -4,14 +4,18 @@ import (
 	"context"
 	"os"
 	"path"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob"
 	"gocloud.dev/blob/fileblob"
 	"gocloud.dev/blob/memblob"
 
 	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/sidecar"
 )
 
 func TestSaveFromArchive(t *testing.T) {
@@ -58,7 +62,7 @@ func TestSaveFromArchive(t *testing.T) {
 			destDir := path.Join(tmpdir, "dest")
 			require.Nil(t, err)
 
-			err = saveFromArchive(ctx, bucket, tarName, destDir)
+			_, err = saveFromArchive(ctx, bucketSource{bucket}, tarName, path.Join(tmpdir, "spool"), destDir, 0)
 			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
 			if err != nil {
 				return
@@ -71,6 +75,205 @@ func TestSaveFromArchive(t *testing.T) {
 	}
 }
 
+func TestFind_Selection(t *testing.T) {
+	keys := []string{
+		"2022-06-10-00-00-00/a.tar.gz",
+		"2022-06-10-00-00-00/b.tar.gz",
+		"2022-06-12-12-00-00/a.tar.gz",
+		"2022-06-13-00-00-00/a.tar.gz",
+		"2022-06-13-00-00-00/b.tar.gz",
+	}
+	tests := []struct {
+		name      string
+		setName   string
+		timestamp string
+		wantSet   string
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:    "latest",
+			wantSet: "2022-06-13-00-00-00",
+			want:    []string{"2022-06-13-00-00-00/a.tar.gz", "2022-06-13-00-00-00/b.tar.gz"},
+		},
+		{
+			name:    "exact name",
+			setName: "2022-06-12-12-00-00",
+			wantSet: "2022-06-12-12-00-00",
+			want:    []string{"2022-06-12-12-00-00/a.tar.gz"},
+		},
+		{
+			name:    "exact name with trailing slash",
+			setName: "2022-06-10-00-00-00/",
+			wantSet: "2022-06-10-00-00-00",
+			want:    []string{"2022-06-10-00-00-00/a.tar.gz", "2022-06-10-00-00-00/b.tar.gz"},
+		},
+		{
+			name:    "unknown name",
+			setName: "2022-06-11-00-00-00",
+			wantErr: true,
+		},
+		{
+			name:      "timestamp between sets",
+			timestamp: "2022-06-12T23:59:59Z",
+			wantSet:   "2022-06-12-12-00-00",
+			want:      []string{"2022-06-12-12-00-00/a.tar.gz"},
+		},
+		{
+			name:      "timestamp with zone",
+			timestamp: "2022-06-13T01:00:00+02:00",
+			wantSet:   "2022-06-12-12-00-00",
+			want:      []string{"2022-06-12-12-00-00/a.tar.gz"},
+		},
+		{
+			name:      "timestamp equal to set",
+			timestamp: "2022-06-10-00-00-00",
+			wantSet:   "2022-06-10-00-00-00",
+			want:      []string{"2022-06-10-00-00-00/a.tar.gz", "2022-06-10-00-00-00/b.tar.gz"},
+		},
+		{
+			name:      "timestamp before all sets",
+			timestamp: "2022-06-09T00:00:00Z",
+			wantErr:   true,
+		},
+		{
+			name:      "invalid timestamp",
+			timestamp: "yesterday",
+			wantErr:   true,
+		},
+		{
+			name:      "name and timestamp",
+			setName:   "2022-06-10-00-00-00",
+			timestamp: "2022-06-10-00-00-00",
+			wantErr:   true,
+		},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// setup
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+			for _, k := range keys {
+				err := bucket.WriteAll(ctx, k, []byte(""), nil)
+				require.Nil(t, err)
+			}
+
+			// test
+			sel, err := newBackupSelector(tt.setName, tt.timestamp)
+			if err == nil {
+				var set string
+				var got []string
+				set, got, err = find(ctx, bucket, sel)
+				if err == nil {
+					require.Equal(t, tt.wantSet, set)
+					require.Equal(t, tt.want, got)
+				}
+			}
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+		})
+	}
+}
+
+func TestFind_SelectionWithoutBackupSets(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	require.Nil(t, bucket.WriteAll(ctx, "a.tar.gz", []byte(""), nil))
+
+	_, _, err := find(ctx, bucket, backupSelector{before: time.Now()})
+	require.ErrorContains(t, err, "there are no backup sets in the bucket")
+}
+
+func TestMemberArchive(t *testing.T) {
+	const set = "2022-06-13-00-00-00"
+	tests := []struct {
+		name    string
+		members map[string]string
+		id      int
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "legacy order",
+			members: map[string]string{"a.tar.gz": "", "b.tar.gz": ""},
+			id:      1,
+			want:    "b.tar.gz",
+		},
+		{
+			name:    "legacy order out of index",
+			members: map[string]string{"a.tar.gz": "", "b.tar.gz": ""},
+			id:      2,
+			wantErr: "backup set 2022-06-13-00-00-00 has 2 archived backup files, member index 2 needs at least 3",
+		},
+		{
+			name:    "metadata differs from order",
+			members: map[string]string{"a.tar.gz": "1", "b.tar.gz": "0"},
+			id:      0,
+			want:    "b.tar.gz",
+		},
+		{
+			name:    "scale down",
+			members: map[string]string{"a.tar.gz": "2", "b.tar.gz": "0", "c.tar.gz": "1"},
+			id:      1,
+			want:    "c.tar.gz",
+		},
+		{
+			name:    "scale up",
+			members: map[string]string{"a.tar.gz": "1", "b.tar.gz": "0"},
+			id:      2,
+			wantErr: "there is no archive uploaded by member 2, archives are uploaded by members [0 1]",
+		},
+		{
+			name:    "duplicate member",
+			members: map[string]string{"a.tar.gz": "0", "b.tar.gz": "0"},
+			id:      0,
+			wantErr: "archives a.tar.gz and b.tar.gz are both uploaded by member 0",
+		},
+		{
+			name:    "partial metadata",
+			members: map[string]string{"a.tar.gz": "0", "b.tar.gz": ""},
+			id:      0,
+			wantErr: "archives b.tar.gz have no member metadata unlike the other archives",
+		},
+		{
+			name:    "invalid metadata",
+			members: map[string]string{"a.tar.gz": "first"},
+			id:      0,
+			wantErr: `invalid member id "first" in the metadata of a.tar.gz`,
+		},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// setup
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+			var keys []string
+			for k, member := range tt.members {
+				opts := &blob.WriterOptions{}
+				if member != "" {
+					opts.Metadata = map[string]string{sidecar.MemberIDMetadataKey: member}
+				}
+				require.Nil(t, bucket.WriteAll(ctx, k, []byte(""), opts))
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			// test
+			got, err := memberArchive(ctx, bucket, set, keys, tt.id)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
 func TestParseID(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -173,7 +376,7 @@ func TestFind(t *testing.T) {
 			}
 
 			// test
-			got, err := find(ctx, bucket)
+			_, got, err := find(ctx, bucket, backupSelector{})
 			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
 			if err != nil {
 				return
@@ -0,0 +1,131 @@
+package restore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// copyMode is the way the local backup files are placed at the destination
+type copyMode string
+
+const (
+	// copyModeAuto uses reflinks if the filesystem supports them and copies the bytes otherwise
+	copyModeAuto copyMode = "auto"
+	// copyModeHardlink links the backup files, the restored files share their data with the backup. Files written
+	// in place change the backup too, so it is used only for backups which were already uploaded.
+	copyModeHardlink copyMode = "hardlink"
+	// copyModeReflink clones the backup files, the data is shared until one of the files is modified
+	copyModeReflink copyMode = "reflink"
+	copyModeCopy    copyMode = "copy"
+)
+
+// errReflinkUnsupported is returned by reflink on platforms without copy-on-write clones
+var errReflinkUnsupported = errors.New("reflinks are not supported on this platform")
+
+func parseCopyMode(s string) (copyMode, error) {
+	switch m := copyMode(s); m {
+	case "":
+		return copyModeAuto, nil
+	case copyModeAuto, copyModeHardlink, copyModeReflink, copyModeCopy:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid copy mode %q, expected one of %s, %s, %s or %s", s, copyModeAuto, copyModeHardlink, copyModeReflink, copyModeCopy)
+	}
+}
+
+// copier places files in the requested mode. If the mode fails, e.g. the source and the destination are on
+// different filesystems, it falls back to the next mode for the remaining files: hardlink, reflink and then copy.
+type copier struct {
+	mode copyMode
+	// files counts the files placed in each mode
+	files map[copyMode]int
+}
+
+func newCopier(mode copyMode) *copier {
+	if mode == copyModeAuto {
+		mode = copyModeReflink
+	}
+	return &copier{mode: mode, files: map[copyMode]int{}}
+}
+
+// used returns the mode used for most of the files
+func (c *copier) used() copyMode {
+	used := c.mode
+	for _, m := range []copyMode{copyModeCopy, copyModeReflink, copyModeHardlink} {
+		if c.files[m] > c.files[used] {
+			used = m
+		}
+	}
+	return used
+}
+
+func (c *copier) fallback(mode copyMode, err error) {
+	localInPVCLog.Warn(fmt.Sprintf("%s failed, falling back to %s: %s", c.mode, mode, err.Error()))
+	c.mode = mode
+}
+
+// copyDir copies the source directory tree to the destination, which must not exist
+func (c *copier) copyDir(source, destination string) error {
+	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		var out = filepath.Join(destination, strings.TrimPrefix(path, source))
+
+		if info.IsDir() {
+			return os.Mkdir(out, info.Mode())
+		}
+		return c.copyFile(path, out, info.Mode())
+	})
+}
+
+func (c *copier) copyFile(src, dst string, mode fs.FileMode) error {
+	if c.mode == copyModeHardlink && mode.IsRegular() {
+		err := os.Link(src, dst)
+		if err == nil {
+			c.files[copyModeHardlink]++
+			return nil
+		}
+		c.fallback(copyModeReflink, err)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	placed := copyModeCopy
+	if c.mode == copyModeReflink && mode.IsRegular() {
+		if err = reflink(out, in); err == nil {
+			placed = copyModeReflink
+		} else {
+			c.fallback(copyModeCopy, err)
+		}
+	}
+	if placed == copyModeCopy {
+		if _, err = io.Copy(out, in); err != nil {
+			return err
+		}
+	}
+
+	if err = out.Chmod(mode.Perm()); err != nil {
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	c.files[placed]++
+	return nil
+}
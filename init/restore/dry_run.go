@@ -0,0 +1,166 @@
+package restore
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+// restorePlan describes what a restore would do, it is the result of a dry run
+type restorePlan struct {
+	// Source is the bucket URI or the local backup sequence folder
+	Source string
+	// BackupSet is the selected backup set in the bucket, if any
+	BackupSet string
+	// Archive is the archive key or the local backup UUID directory
+	Archive       string
+	ArchiveSize   int64
+	Entries       int
+	ExtractedSize int64
+	// Deleted are the hot-restart UUID directories replaced at the destination
+	Deleted []string
+}
+
+func (p restorePlan) log(l *zap.Logger) {
+	l.Info("dry run, the destination is not changed",
+		zap.String("source", p.Source),
+		zap.String("backup set", p.BackupSet),
+		zap.String("archive", p.Archive),
+		zap.Int64("archive size", p.ArchiveSize),
+		zap.Int("entries", p.Entries),
+		zap.Int64("extracted size", p.ExtractedSize),
+		zap.Strings("deleted UUID directories", p.Deleted),
+	)
+}
+
+// planBucketToPvc resolves the archive of the member and reads it without writing to the destination
+func planBucketToPvc(ctx context.Context, src, dst string, id int, secretName string, sel backupSelector) (restorePlan, error) {
+	b, err := bucket.OpenBucket(ctx, src, secretName)
+	if err != nil {
+		return restorePlan{}, err
+	}
+	defer b.Close()
+
+	set, key, err := findMemberArchive(ctx, b, id, sel)
+	if err != nil {
+		return restorePlan{}, err
+	}
+	plan := restorePlan{Source: src, BackupSet: set, Archive: key}
+	if err = plan.readArchive(ctx, bucketSource{b}, key); err != nil {
+		return restorePlan{}, err
+	}
+
+	if plan.Deleted, err = destinationUUIDs(dst); err != nil {
+		return restorePlan{}, err
+	}
+	return plan, nil
+}
+
+// planURLToPvc reads the archive at the URL without writing to the destination
+func planURLToPvc(ctx context.Context, src urlSource, key, dst string) (restorePlan, error) {
+	plan := restorePlan{Source: key, Archive: key}
+	if err := plan.readArchive(ctx, src, key); err != nil {
+		return restorePlan{}, err
+	}
+
+	var err error
+	if plan.Deleted, err = destinationUUIDs(dst); err != nil {
+		return restorePlan{}, err
+	}
+	return plan, nil
+}
+
+// readArchive sets the archive size and counts the archive entries
+func (p *restorePlan) readArchive(ctx context.Context, src archiveSource, key string) error {
+	attrs, err := src.attributes(ctx, key)
+	if err != nil {
+		return err
+	}
+	p.ArchiveSize = attrs.Size
+
+	r, err := src.newRangeReader(ctx, key, 0)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	g, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", key, err)
+	}
+	defer g.Close()
+
+	t := tar.NewReader(g)
+	for {
+		header, err := t.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read %s: %w", key, err)
+		}
+		p.Entries++
+		if header.Typeflag == tar.TypeReg {
+			p.ExtractedSize += header.Size
+		}
+	}
+}
+
+// planLocalInPVC resolves the member's backup UUID directory of the sequence folder without writing to the destination
+func planLocalInPVC(src string, id int, dst string) (restorePlan, error) {
+	bk, err := memberUUID(src, id)
+	if err != nil {
+		return restorePlan{}, err
+	}
+	plan := restorePlan{Source: src, Archive: bk}
+
+	err = filepath.WalkDir(path.Join(src, plan.Archive), func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		plan.Entries++
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			plan.ExtractedSize += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return restorePlan{}, err
+	}
+	plan.ArchiveSize = plan.ExtractedSize
+
+	if plan.Deleted, err = destinationUUIDs(dst); err != nil {
+		return restorePlan{}, err
+	}
+	return plan, nil
+}
+
+// destinationUUIDs returns the names of the hot-restart UUID directories in dst
+func destinationUUIDs(dst string) ([]string, error) {
+	uuids, err := fileutil.FolderUUIDs(dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(uuids))
+	for _, uuid := range uuids {
+		names = append(names, uuid.Name())
+	}
+	return names, nil
+}
@@ -0,0 +1,101 @@
+package restore
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/google/subcommands"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+var dryRunDestFiles = []fileutil.File{
+	{Name: oldUUID, IsDir: true},
+	{Name: oldUUID + "/old-file"},
+	{Name: "00000000-0000-0000-0000-00000000000b", IsDir: true},
+}
+
+func TestDryRunBucketToPVC(t *testing.T) {
+	// Set up
+	tmpdir := t.TempDir()
+	archiveDir := path.Join(tmpdir, "archive")
+	require.Nil(t, fileutil.CreateFiles(archiveDir, exampleTarGzFiles, true))
+	bucketPath := path.Join(tmpdir, "bucket")
+	for _, key := range []string{
+		"2006-01-02-15-04-01/00000000-0000-0000-0000-000000000001.tar.gz",
+		"2006-01-02-15-04-02/00000000-0000-0000-0000-000000000001.tar.gz",
+		"2006-01-02-15-04-02/00000000-0000-0000-0000-000000000002.tar.gz",
+	} {
+		require.Nil(t, createArchiveFile(archiveDir, strings.TrimSuffix(path.Base(key), ".tar.gz"), path.Join(bucketPath, key)))
+	}
+	dst := path.Join(tmpdir, "dest")
+	require.Nil(t, fileutil.CreateFiles(dst, dryRunDestFiles, true))
+
+	// Run test
+	plan, err := planBucketToPvc(context.Background(), "file://"+bucketPath, dst, 1, "", backupSelector{})
+	require.Nil(t, err)
+	info, err := os.Stat(path.Join(bucketPath, "2006-01-02-15-04-02/00000000-0000-0000-0000-000000000002.tar.gz"))
+	require.Nil(t, err)
+	require.Equal(t, restorePlan{
+		Source:        "file://" + bucketPath,
+		BackupSet:     "2006-01-02-15-04-02",
+		Archive:       "2006-01-02-15-04-02/00000000-0000-0000-0000-000000000002.tar.gz",
+		ArchiveSize:   info.Size(),
+		Entries:       len(exampleTarGzFiles) + 1,
+		ExtractedSize: 0,
+		Deleted:       []string{oldUUID, "00000000-0000-0000-0000-00000000000b"},
+	}, plan)
+
+	t.Setenv("HOSTNAME", "hz-1")
+	cmd := &BucketToPVCCmd{Bucket: "file://" + bucketPath, Destination: dst, DryRun: true}
+	require.Equal(t, subcommands.ExitSuccess, cmd.Execute(context.Background(), &flag.FlagSet{}))
+	require.ElementsMatch(t, dryRunDestFiles, mustDirFileList(t, dst))
+}
+
+func TestDryRunLocalInPVC(t *testing.T) {
+	// Set up
+	tmpdir := t.TempDir()
+	src := path.Join(tmpdir, "hot-backup", "backup-1659034855438")
+	require.Nil(t, fileutil.CreateFiles(src, []fileutil.File{
+		{Name: newUUID, IsDir: true},
+		{Name: newUUID + "/cluster", IsDir: true},
+		{Name: newUUID + "/cluster/members.bin"},
+	}, true))
+	require.Nil(t, os.WriteFile(path.Join(src, newUUID, "cluster/members.bin"), []byte("members"), 0600))
+	dst := path.Join(tmpdir, "dest")
+	require.Nil(t, fileutil.CreateFiles(dst, dryRunDestFiles, true))
+
+	// Run test
+	plan, err := planLocalInPVC(src, 0, dst)
+	require.Nil(t, err)
+	require.Equal(t, restorePlan{
+		Source:        src,
+		Archive:       newUUID,
+		ArchiveSize:   7,
+		Entries:       3,
+		ExtractedSize: 7,
+		Deleted:       []string{oldUUID, "00000000-0000-0000-0000-00000000000b"},
+	}, plan)
+
+	_, err = planLocalInPVC(src, 0, path.Join(tmpdir, "missing"))
+	require.Nil(t, err)
+
+	t.Setenv("HOSTNAME", "hz-0")
+	cmd := &LocalInPVCCmd{
+		BackupSequenceFolderName: "backup-1659034855438",
+		BackupSourceBaseDir:      tmpdir,
+		BackupDestinationBaseDir: dst,
+		BackupDir:                "hot-backup",
+		DryRun:                   true,
+	}
+	require.Equal(t, subcommands.ExitSuccess, cmd.Execute(context.Background(), &flag.FlagSet{}))
+	require.ElementsMatch(t, dryRunDestFiles, mustDirFileList(t, dst))
+	entries, err := os.ReadDir(tmpdir)
+	require.Nil(t, err)
+	require.Len(t, entries, 2)
+}
@@ -0,0 +1,267 @@
+package restore
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultMaxExtractSize limits the extracted size of an archive if no limit is configured
+const defaultMaxExtractSize int64 = 1 << 40 // 1 TiB
+
+var errRejectedEntry = errors.New("rejected archive entry")
+
+// extractor writes the entries of a tar archive below the target directory.
+// Entries escaping the target, directly or through links, are rejected.
+type extractor struct {
+	target   string
+	maxSize  int64
+	size     int64
+	symlinks []string
+	// dirs are finalized after their contents are written
+	dirs []*tar.Header
+	// chown restores the ownership, it requires root
+	chown bool
+}
+
+func extractArchive(r io.Reader, target string, maxSize int64) error {
+	if maxSize <= 0 {
+		maxSize = defaultMaxExtractSize
+	}
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	e := &extractor{target: target, maxSize: maxSize, chown: os.Geteuid() == 0}
+
+	t := tar.NewReader(r)
+	for {
+		header, err := t.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err = e.extract(header, t); err != nil {
+			return err
+		}
+	}
+
+	if err = e.checkSymlinks(); err != nil {
+		return err
+	}
+	return e.finalizeDirs()
+}
+
+func rejectEntry(name, format string, a ...interface{}) error {
+	return fmt.Errorf("%w %q: %s", errRejectedEntry, name, fmt.Sprintf(format, a...))
+}
+
+func (e *extractor) extract(header *tar.Header, src io.Reader) error {
+	rel, err := e.localPath(header.Name)
+	if err != nil {
+		return err
+	}
+	if err = e.checkParents(header.Name, rel); err != nil {
+		return err
+	}
+	name := filepath.Join(e.target, rel)
+
+	if header.Typeflag != tar.TypeDir {
+		// never write through a symlink left by a previous entry or restore
+		if err = removeSymlink(name); err != nil {
+			return err
+		}
+	}
+
+	mode := header.FileInfo().Mode()
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if fi, err := os.Lstat(name); err == nil && fi.Mode()&fs.ModeSymlink != 0 {
+			return rejectEntry(header.Name, "directory replaces the symlink %s", rel)
+		}
+		// the directory stays writable until its contents are written
+		if err = os.MkdirAll(name, 0700); err != nil {
+			return err
+		}
+		h := *header
+		h.Name = name
+		e.dirs = append(e.dirs, &h)
+		return nil
+	case tar.TypeReg:
+		if e.size+header.Size > e.maxSize {
+			return rejectEntry(header.Name, "archive exceeds the maximum extracted size of %d bytes", e.maxSize)
+		}
+		e.size += header.Size
+		if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		if err = saveFile(name, mode, src); err != nil {
+			return err
+		}
+		return e.setMetadata(name, header)
+	case tar.TypeFifo:
+		if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		if err = mkfifo(name); err != nil {
+			return err
+		}
+		if err = os.Chmod(name, mode.Perm()); err != nil {
+			return err
+		}
+		return e.setMetadata(name, header)
+	case tar.TypeSymlink:
+		if filepath.IsAbs(header.Linkname) {
+			return rejectEntry(header.Name, "symlink to the absolute path %s", header.Linkname)
+		}
+		if !filepath.IsLocal(filepath.Join(filepath.Dir(rel), header.Linkname)) {
+			return rejectEntry(header.Name, "symlink to %s escapes the target directory", header.Linkname)
+		}
+		if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		e.symlinks = append(e.symlinks, name)
+		if err = os.Symlink(header.Linkname, name); err != nil {
+			return err
+		}
+		return e.setMetadata(name, header)
+	case tar.TypeLink:
+		linkRel, err := e.localPath(header.Linkname)
+		if err != nil {
+			return rejectEntry(header.Name, "hardlink to %s escapes the target directory", header.Linkname)
+		}
+		if err = e.checkParents(header.Name, linkRel); err != nil {
+			return err
+		}
+		linkName := filepath.Join(e.target, linkRel)
+		fi, err := os.Lstat(linkName)
+		if err != nil {
+			return rejectEntry(header.Name, "hardlink to the missing file %s", header.Linkname)
+		}
+		if !fi.Mode().IsRegular() {
+			return rejectEntry(header.Name, "hardlink to %s which is not a regular file", header.Linkname)
+		}
+		if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		return os.Link(linkName, name)
+	default:
+		return rejectEntry(header.Name, "unsupported entry type %q", header.Typeflag)
+	}
+}
+
+// setMetadata restores the ownership and the modification time of the entry, without following symlinks
+func (e *extractor) setMetadata(name string, header *tar.Header) error {
+	if e.chown {
+		if err := os.Lchown(name, header.Uid, header.Gid); err != nil {
+			return err
+		}
+	}
+	atime := header.AccessTime
+	if atime.IsZero() {
+		atime = header.ModTime
+	}
+	if header.Typeflag == tar.TypeSymlink {
+		return lutimes(name, atime, header.ModTime)
+	}
+	return os.Chtimes(name, atime, header.ModTime)
+}
+
+// finalizeDirs applies the mode and metadata of the directories, children before their parents
+func (e *extractor) finalizeDirs() error {
+	for i := len(e.dirs) - 1; i >= 0; i-- {
+		h := e.dirs[i]
+		if err := os.Chmod(h.Name, h.FileInfo().Mode().Perm()); err != nil {
+			return err
+		}
+		if err := e.setMetadata(h.Name, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// localPath returns the entry path relative to the target
+func (e *extractor) localPath(name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", rejectEntry(name, "absolute path")
+	}
+	rel := filepath.Clean(filepath.FromSlash(name))
+	if !filepath.IsLocal(rel) {
+		return "", rejectEntry(name, "path escapes the target directory")
+	}
+	return rel, nil
+}
+
+// checkParents rejects the entry if any existing parent directory of rel is a symlink
+func (e *extractor) checkParents(entry, rel string) error {
+	dir := e.target
+	for _, part := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+		dir = filepath.Join(dir, part)
+		fi, err := os.Lstat(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			return rejectEntry(entry, "path passes through the symlink %s", strings.TrimPrefix(dir, e.target+string(filepath.Separator)))
+		}
+	}
+	return nil
+}
+
+// checkSymlinks makes sure that the extracted symlinks resolve below the target, also through other symlinks
+func (e *extractor) checkSymlinks() error {
+	target, err := filepath.EvalSymlinks(e.target)
+	if err != nil {
+		return err
+	}
+	for _, link := range e.symlinks {
+		resolved, err := filepath.EvalSymlinks(link)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err == nil {
+			var rel string
+			rel, err = filepath.Rel(target, resolved)
+			if err == nil && filepath.IsLocal(rel) {
+				continue
+			}
+		}
+		if rmErr := os.Remove(link); rmErr != nil {
+			return rmErr
+		}
+		rel, _ := filepath.Rel(e.target, link)
+		return rejectEntry(filepath.ToSlash(rel), "symlink escapes the target directory")
+	}
+	return nil
+}
+
+func removeSymlink(name string) error {
+	fi, err := os.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&fs.ModeSymlink != 0 {
+		return os.Remove(name)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package restore
+
+import (
+	"errors"
+	"time"
+)
+
+func mkfifo(string) error {
+	return errors.New("named pipes are not supported on this platform")
+}
+
+// lutimes is a no-op, symlink times cannot be changed on this platform
+func lutimes(string, time.Time, time.Time) error {
+	return nil
+}
@@ -0,0 +1,243 @@
+package restore
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type entry struct {
+	name     string
+	typeflag byte
+	linkname string
+	body     string
+}
+
+func tarArchive(t *testing.T, entries []entry) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	w := tar.NewWriter(buf)
+	for _, e := range entries {
+		h := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Linkname: e.linkname,
+			Mode:     0644,
+			Size:     int64(len(e.body)),
+		}
+		if e.typeflag == tar.TypeDir {
+			h.Mode = 0755
+		}
+		if e.typeflag != tar.TypeReg {
+			h.Size = 0
+		}
+		require.Nil(t, w.WriteHeader(h))
+		if h.Size > 0 {
+			_, err := w.Write([]byte(e.body))
+			require.Nil(t, err)
+		}
+	}
+	require.Nil(t, w.Close())
+	return buf
+}
+
+func TestExtractArchive(t *testing.T) {
+	tests := []struct {
+		name        string
+		entries     []entry
+		maxSize     int64
+		wantEntry   string
+		wantMessage string
+	}{
+		{
+			name: "valid archive",
+			entries: []entry{
+				{name: "dir", typeflag: tar.TypeDir},
+				{name: "dir/file", typeflag: tar.TypeReg, body: "content"},
+				{name: "./dir/sub/nested", typeflag: tar.TypeReg, body: "nested"},
+				{name: "dir/link", typeflag: tar.TypeSymlink, linkname: "sub/nested"},
+				{name: "dir/hardlink", typeflag: tar.TypeLink, linkname: "dir/file"},
+				{name: "root-link", typeflag: tar.TypeSymlink, linkname: "."},
+				{name: "dangling", typeflag: tar.TypeSymlink, linkname: "dir/missing"},
+			},
+		},
+		{
+			name:        "absolute path",
+			entries:     []entry{{name: "/outside/evil", typeflag: tar.TypeReg, body: "evil"}},
+			wantEntry:   "/outside/evil",
+			wantMessage: "absolute path",
+		},
+		{
+			name:        "parent traversal",
+			entries:     []entry{{name: "../outside/evil", typeflag: tar.TypeReg, body: "evil"}},
+			wantEntry:   "../outside/evil",
+			wantMessage: "path escapes the target directory",
+		},
+		{
+			name:        "nested parent traversal",
+			entries:     []entry{{name: "dir/../../outside/evil", typeflag: tar.TypeReg, body: "evil"}},
+			wantEntry:   "dir/../../outside/evil",
+			wantMessage: "path escapes the target directory",
+		},
+		{
+			name:        "relative symlink escaping the target",
+			entries:     []entry{{name: "dir/link", typeflag: tar.TypeSymlink, linkname: "../../outside"}},
+			wantEntry:   "dir/link",
+			wantMessage: "symlink to ../../outside escapes the target directory",
+		},
+		{
+			name:        "absolute symlink",
+			entries:     []entry{{name: "link", typeflag: tar.TypeSymlink, linkname: "/etc"}},
+			wantEntry:   "link",
+			wantMessage: "symlink to the absolute path /etc",
+		},
+		{
+			name: "write through a symlink",
+			entries: []entry{
+				{name: "dir", typeflag: tar.TypeDir},
+				{name: "link", typeflag: tar.TypeSymlink, linkname: "dir"},
+				{name: "link/evil", typeflag: tar.TypeReg, body: "evil"},
+			},
+			wantEntry:   "link/evil",
+			wantMessage: "path passes through the symlink link",
+		},
+		{
+			name: "symlink escaping through another symlink",
+			entries: []entry{
+				{name: "self", typeflag: tar.TypeSymlink, linkname: "."},
+				{name: "escape", typeflag: tar.TypeSymlink, linkname: "self/self/self/.."},
+			},
+			wantEntry:   "escape",
+			wantMessage: "symlink escapes the target directory",
+		},
+		{
+			name:        "hardlink escaping the target",
+			entries:     []entry{{name: "hardlink", typeflag: tar.TypeLink, linkname: "../outside/file"}},
+			wantEntry:   "hardlink",
+			wantMessage: "hardlink to ../outside/file escapes the target directory",
+		},
+		{
+			name: "hardlink to a symlink",
+			entries: []entry{
+				{name: "link", typeflag: tar.TypeSymlink, linkname: "missing"},
+				{name: "hardlink", typeflag: tar.TypeLink, linkname: "link"},
+			},
+			wantEntry:   "hardlink",
+			wantMessage: "hardlink to link which is not a regular file",
+		},
+		{
+			name: "maximum size exceeded",
+			entries: []entry{
+				{name: "file1", typeflag: tar.TypeReg, body: "12345"},
+				{name: "file2", typeflag: tar.TypeReg, body: "123456"},
+			},
+			maxSize:     10,
+			wantEntry:   "file2",
+			wantMessage: "archive exceeds the maximum extracted size of 10 bytes",
+		},
+		{
+			name:        "device file",
+			entries:     []entry{{name: "dev", typeflag: tar.TypeChar}},
+			wantEntry:   "dev",
+			wantMessage: "unsupported entry type",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set up
+			tmpdir := t.TempDir()
+			outside := path.Join(tmpdir, "outside")
+			require.Nil(t, os.Mkdir(outside, 0755))
+			require.Nil(t, os.WriteFile(path.Join(outside, "file"), []byte("outside"), 0644))
+			target := path.Join(tmpdir, "target")
+
+			// Run test
+			err := extractArchive(tarArchive(t, tt.entries), target, tt.maxSize)
+			require.NoFileExists(t, path.Join(outside, "evil"))
+			if tt.wantEntry == "" {
+				require.Nil(t, err)
+				content, err := os.ReadFile(path.Join(target, "dir/link"))
+				require.Nil(t, err)
+				require.Equal(t, "nested", string(content))
+				content, err = os.ReadFile(path.Join(target, "dir/hardlink"))
+				require.Nil(t, err)
+				require.Equal(t, "content", string(content))
+				return
+			}
+
+			require.ErrorIs(t, err, errRejectedEntry)
+			require.ErrorContains(t, err, `"`+tt.wantEntry+`"`)
+			require.ErrorContains(t, err, tt.wantMessage)
+		})
+	}
+}
+
+func TestExtractArchive_RemovesEscapingSymlink(t *testing.T) {
+	target := t.TempDir()
+	err := extractArchive(tarArchive(t, []entry{
+		{name: "self", typeflag: tar.TypeSymlink, linkname: "."},
+		{name: "escape", typeflag: tar.TypeSymlink, linkname: "self/self/.."},
+	}), target, 0)
+	require.ErrorIs(t, err, errRejectedEntry)
+
+	_, err = os.Lstat(path.Join(target, "escape"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestExtractArchive_PreservesMetadata(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes and named pipes are not supported on windows")
+	}
+
+	// Set up
+	tmpdir := t.TempDir()
+	src := path.Join(tmpdir, "src", newUUID)
+	mtime := time.Date(2022, 7, 29, 0, 10, 0, 0, time.UTC)
+	require.Nil(t, os.MkdirAll(path.Join(src, "readonly"), 0750))
+	require.Nil(t, os.WriteFile(path.Join(src, "readonly", "file"), []byte("content"), 0640))
+	require.Nil(t, os.Symlink("readonly/file", path.Join(src, "link")))
+	require.Nil(t, mkfifo(path.Join(src, "pipe")))
+	require.Nil(t, os.Chmod(path.Join(src, "pipe"), 0640))
+	require.Nil(t, os.Chtimes(path.Join(src, "readonly", "file"), mtime, mtime))
+	require.Nil(t, os.Chtimes(path.Join(src, "readonly"), mtime, mtime))
+	require.Nil(t, os.Chmod(path.Join(src, "readonly"), 0550))
+	defer os.Chmod(path.Join(src, "readonly"), 0750)
+
+	archive := path.Join(tmpdir, "archive.tar.gz")
+	require.Nil(t, createArchiveFile(src, newUUID, archive))
+	f, err := os.Open(archive)
+	require.Nil(t, err)
+	defer f.Close()
+	g, err := gzip.NewReader(f)
+	require.Nil(t, err)
+
+	// Run test
+	target := path.Join(tmpdir, "target")
+	require.Nil(t, extractArchive(g, target, 0))
+	dst := path.Join(target, newUUID)
+	defer os.Chmod(path.Join(dst, "readonly"), 0750)
+
+	info, err := os.Stat(path.Join(dst, "readonly"))
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0550)|os.ModeDir, info.Mode())
+	require.True(t, mtime.Equal(info.ModTime()))
+
+	info, err = os.Stat(path.Join(dst, "readonly", "file"))
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0640), info.Mode())
+	require.True(t, mtime.Equal(info.ModTime()))
+
+	link, err := os.Readlink(path.Join(dst, "link"))
+	require.Nil(t, err)
+	require.Equal(t, "readonly/file", link)
+
+	info, err = os.Lstat(path.Join(dst, "pipe"))
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0640)|os.ModeNamedPipe, info.Mode())
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package restore
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func mkfifo(name string) error {
+	return unix.Mkfifo(name, 0600)
+}
+
+func lutimes(name string, atime, mtime time.Time) error {
+	return unix.Lutimes(name, []unix.Timeval{unix.NsecToTimeval(atime.UnixNano()), unix.NsecToTimeval(mtime.UnixNano())})
+}
@@ -4,20 +4,20 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"io"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
-	"strings"
 
 	"github.com/google/subcommands"
 	"github.com/kelseyhightower/envconfig"
+	"go.uber.org/zap"
 	_ "gocloud.dev/blob/azureblob"
 	_ "gocloud.dev/blob/gcsblob"
 	_ "gocloud.dev/blob/s3blob"
 
 	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/k8s"
 	"github.com/hazelcast/platform-operator-agent/internal/logger"
 )
 
@@ -42,6 +42,9 @@ type LocalInPVCCmd struct {
 	BackupDestinationBaseDir string `envconfig:"RESTORE_LOCAL_BACKUP_DEST_BASE_DIR" yaml:"backupDestinationBaseDir"`
 	BackupDir                string `envconfig:"RESTORE_LOCAL_BACKUP_BACKUP_DIR" yaml:"backupDir"`
 	RestoreID                string `envconfig:"RESTORE_LOCAL_ID" yaml:"restoreID"`
+	DryRun                   bool   `envconfig:"RESTORE_LOCAL_DRY_RUN" yaml:"dryRun"`
+	CopyMode                 string `envconfig:"RESTORE_LOCAL_COPY_MODE" yaml:"copyMode"`
+	Ordinal                  string `envconfig:"RESTORE_LOCAL_ORDINAL" yaml:"ordinal"`
 }
 
 func (*LocalInPVCCmd) Name() string     { return "restore_pvc_local" }
@@ -49,13 +52,16 @@ func (*LocalInPVCCmd) Synopsis() string { return "run restore pvc local agent" }
 func (*LocalInPVCCmd) Usage() string    { return "" }
 
 func (r *LocalInPVCCmd) SetFlags(f *flag.FlagSet) {
-	f.StringVar(&r.BackupSequenceFolderName, "src", "", "src backup folder path")
+	f.StringVar(&r.BackupSequenceFolderName, "src", "", "src backup sequence folder name, the newest one with a backup of the member if empty")
 	f.StringVar(&r.BackupSourceBaseDir, "dst", "/data/persistence/backup", "dst filesystem path")
 	f.StringVar(&r.BackupDir, "backup-dir", "hot-backup", "relative directory of hot backup")
 	f.StringVar(&r.RestoreID, "restore-id", "", "Restore ID for which the lock will be created.")
+	f.BoolVar(&r.DryRun, "dry-run", false, "log what the restore would do without changing the destination")
+	f.StringVar(&r.CopyMode, "copy-mode", string(copyModeAuto), "how backup files are placed: auto, hardlink, reflink or copy. hardlink is used only for uploaded backups, in-place writes would change the backup, and also selects the uploaded sequences if -src is empty")
+	f.StringVar(&r.Ordinal, "ordinal", "", "member index, resolved from the pod-index label or the hostname if empty")
 }
 
-func (r *LocalInPVCCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+func (r *LocalInPVCCmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
 	localInPVCLog.Info("starting restore pvc local agent...")
 
 	// overwrite config with environment variables
@@ -64,16 +70,20 @@ func (r *LocalInPVCCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interfa
 		return subcommands.ExitFailure
 	}
 
-	hostname := os.Getenv("HOSTNAME")
-
-	if !hostnameRE.MatchString(hostname) {
-		localInPVCLog.Error("invalid hostname, need to conform to statefulset naming scheme")
+	mode, err := parseCopyMode(r.CopyMode)
+	if err != nil {
+		localInPVCLog.Error(err.Error())
 		return subcommands.ExitFailure
 	}
 
-	id, err := parseID(hostname)
+	var events *k8s.EventRecorder
+	if !r.DryRun {
+		events = k8s.NewEventRecorder()
+	}
+
+	id, err := memberOrdinal(ctx, r.Ordinal, localInPVCLog)
 	if err != nil {
-		localInPVCLog.Error("parse error: " + err.Error())
+		localInPVCLog.Error("member ordinal error: " + err.Error())
 		return subcommands.ExitFailure
 	}
 
@@ -82,106 +92,134 @@ func (r *LocalInPVCCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interfa
 	if _, err = os.Stat(lock); err == nil || os.IsExist(err) {
 		// If restoreLocal lock exists exit
 		localInPVCLog.Info("restore lock exists, exiting")
+		events.Normal(ctx, k8s.ReasonRestoreSkipped, fmt.Sprintf("Restore lock %s exists, skipping the restore", lock))
 		return subcommands.ExitSuccess
 	}
 
-	src := path.Join(r.BackupSourceBaseDir, r.BackupDir, r.BackupSequenceFolderName)
-	err = copyBackupPVC(src, r.BackupDestinationBaseDir)
+	// hardlinks are used only for uploaded backups, which are otherwise skipped
+	src, err := localSequence(path.Join(r.BackupSourceBaseDir, r.BackupDir), r.BackupSequenceFolderName, id, mode == copyModeHardlink)
+	if err != nil {
+		localInPVCLog.Error("backup sequence error: " + err.Error())
+		events.Warning(ctx, k8s.ReasonRestoreFailed, fmt.Sprintf("Failed to restore member %d: %v", id, err))
+		return subcommands.ExitFailure
+	}
+	if r.DryRun {
+		plan, err := planLocalInPVC(src, id, r.BackupDestinationBaseDir)
+		if err != nil {
+			localInPVCLog.Error("dry run error: " + err.Error())
+			return subcommands.ExitFailure
+		}
+		plan.log(localInPVCLog)
+		return subcommands.ExitSuccess
+	}
+
+	bk, used, err := copyBackupPVC(src, id, r.BackupDestinationBaseDir, mode)
 	if err != nil {
 		localInPVCLog.Error("copy backup failed: " + err.Error())
+		events.Warning(ctx, k8s.ReasonRestoreFailed, fmt.Sprintf("Failed to restore member %d from %s: %v", id, src, err))
 		return subcommands.ExitFailure
 	}
-	localInPVCLog.Info(fmt.Sprintf("Backup successfully copied from %s to %s", src, r.BackupDestinationBaseDir))
+	localInPVCLog.Info(fmt.Sprintf("Backup successfully copied from %s to %s", src, r.BackupDestinationBaseDir), zap.String("copy mode", string(used)))
 
 	if err = cleanupLocks(r.BackupSourceBaseDir, id); err != nil {
 		localInPVCLog.Error("error cleaning up locks: " + err.Error())
 		return subcommands.ExitFailure
 	}
 
-	if err = os.WriteFile(lock, []byte{}, 0600); err != nil {
+	if err = writeLock(lock, newLockRecord(src, bk, "")); err != nil {
 		localInPVCLog.Error("lock file creation error: " + err.Error())
 		return subcommands.ExitFailure
 	}
 
 	localInPVCLog.Info("restore successful")
+	events.Normal(ctx, k8s.ReasonRestoreCompleted, fmt.Sprintf("Restored member %d from %s using %s", id, src, used))
 	return subcommands.ExitSuccess
 }
 
-func copyBackupPVC(backupDir, destDir string) error {
-	backupUUIDs, err := fileutil.FolderUUIDs(backupDir)
-	if err != nil {
-		return err
+// localSequence returns the backup sequence folder to restore. If name is empty, it is the newest
+// sequence folder with a backup of the member that is not marked to be deleted after an upload, unless
+// uploaded ones are included.
+func localSequence(backupsDir, name string, id int, includeUploaded bool) (string, error) {
+	if name != "" {
+		return path.Join(backupsDir, name), nil
 	}
 
-	if len(backupUUIDs) != 1 {
-		return fmt.Errorf("incorrect number of backups %d in backup sequence folder", len(backupUUIDs))
+	seqs, err := fileutil.FolderSequence(backupsDir)
+	if err != nil {
+		return "", err
 	}
-
-	if _, err = os.Stat(destDir); os.IsNotExist(err) {
-		err = os.Mkdir(destDir, 0755)
+	// sequence folder names have the same length, ReadDir returns them from the oldest to the newest
+	for i := len(seqs) - 1; i >= 0; i-- {
+		seqDir := path.Join(backupsDir, seqs[i].Name())
+		uuid, err := memberUUID(seqDir, id)
 		if err != nil {
-			return err
+			localInPVCLog.Info("skipping backup sequence: "+err.Error(), zap.String("sequence", seqs[i].Name()))
+			continue
 		}
+		if !includeUploaded && backupUploaded(seqDir, uuid) {
+			localInPVCLog.Info("skipping backup sequence marked to be deleted", zap.String("sequence", seqs[i].Name()))
+			continue
+		}
+		localInPVCLog.Info("selected backup sequence", zap.String("sequence", seqs[i].Name()), zap.String("uuid", uuid))
+		return seqDir, nil
 	}
+	return "", fmt.Errorf("there is no backup sequence of member %d in %s", id, backupsDir)
+}
 
-	destBackupUUIDS, err := fileutil.FolderUUIDs(destDir)
+// memberUUID returns the backup UUID directory of the member in the sequence folder. If there is only one,
+// members are isolated and it is used regardless of the member index, the same as in sidecar.UploadBackup.
+func memberUUID(seqDir string, id int) (string, error) {
+	backupUUIDs, err := fileutil.FolderUUIDs(seqDir)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	// Remove the hot-restart folder at the destination
-	for _, uuid := range destBackupUUIDS {
-		err = os.RemoveAll(path.Join(destDir, uuid.Name()))
-		if err != nil {
-			return err
-		}
+	switch {
+	case len(backupUUIDs) == 0:
+		return "", fmt.Errorf("there are no backups in backup sequence folder")
+	case len(backupUUIDs) == 1:
+		return backupUUIDs[0].Name(), nil
+	case id >= len(backupUUIDs):
+		return "", fmt.Errorf("member index %d is greater than number of backups %d in backup sequence folder", id, len(backupUUIDs))
+	default:
+		return backupUUIDs[id].Name(), nil
 	}
-
-	bk := backupUUIDs[0].Name()
-	return copyDir(path.Join(backupDir, bk), path.Join(destDir, bk))
 }
 
-func lockFileName(restoreId string, memberId int) string {
-	return fmt.Sprintf(".%s.%s.%d", restoreLock, restoreId, memberId)
+// copyBackupPVC copies the backup of the member to the destination. It returns the backup UUID and the copy mode used for most of the files.
+func copyBackupPVC(backupDir string, id int, destDir string, mode copyMode) (string, copyMode, error) {
+	bk, err := memberUUID(backupDir, id)
+	if err != nil {
+		return "", "", err
+	}
+
+	// copy next to the existing hot-restart data, which is kept until the new data is complete
+	st, err := newStage(destDir)
+	if err != nil {
+		return "", "", err
+	}
+	defer st.cleanup()
+
+	// Hazelcast rewrites some hot-restart files in place, which would change the linked backup files too
+	if mode == copyModeHardlink && !backupUploaded(backupDir, bk) {
+		localInPVCLog.Warn("backup is not uploaded yet, falling back from hardlink to reflink to keep it unchanged", zap.String("uuid", bk))
+		mode = copyModeReflink
+	}
+
+	c := newCopier(mode)
+	if err = c.copyDir(path.Join(backupDir, bk), path.Join(st.dir, bk)); err != nil {
+		return "", "", err
+	}
+	return bk, c.used(), st.commit()
 }
 
-func copyDir(source, destination string) error {
-	var err = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		var out = filepath.Join(destination, strings.TrimPrefix(path, source))
+// backupUploaded reports whether the backup was uploaded and is only kept until the sidecar deletes it. Hardlinks
+// to its files are safe, nothing else reads them anymore.
+func backupUploaded(seqDir, uuid string) bool {
+	_, err := os.Stat(path.Join(seqDir, uuid+".delete"))
+	return err == nil
+}
 
-		if info.IsDir() {
-			return os.Mkdir(filepath.Join(out), info.Mode())
-		}
-		err = func() error {
-			in, err := os.Open(path)
-			if err != nil {
-				return err
-			}
-			defer in.Close()
-
-			// create output
-			fh, err := os.Create(out)
-			if err != nil {
-				return err
-			}
-			defer fh.Close()
-
-			// change file mode
-			err = fh.Chmod(info.Mode())
-			if err != nil {
-				return err
-			}
-
-			// copy content
-			_, err = io.Copy(fh, in)
-			return err
-		}()
-
-		return err
-
-	})
-	return err
+func lockFileName(restoreId string, memberId int) string {
+	return fmt.Sprintf(".%s.%s.%d", restoreLock, restoreId, memberId)
 }
@@ -1,10 +1,13 @@
 package restore
 
 import (
+	"context"
+	"flag"
 	"os"
 	"path"
 	"testing"
 
+	"github.com/google/subcommands"
 	"github.com/stretchr/testify/require"
 
 	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
@@ -18,6 +21,7 @@ func TestCopyBackupPVC(t *testing.T) {
 		destUUIDs []fileutil.File
 		want      string
 		wantErr   bool
+		id        int
 	}{
 		{
 			"empty backup dir",
@@ -25,6 +29,7 @@ func TestCopyBackupPVC(t *testing.T) {
 			[]fileutil.File{},
 			"",
 			true,
+			0,
 		},
 		{
 			"single backup",
@@ -36,6 +41,7 @@ func TestCopyBackupPVC(t *testing.T) {
 			},
 			"00000000-0000-0000-0000-000000000001",
 			false,
+			0,
 		},
 		{
 			"incorrect member id but isolated backups",
@@ -47,6 +53,7 @@ func TestCopyBackupPVC(t *testing.T) {
 			},
 			"00000000-0000-0000-0000-000000000001",
 			false,
+			0,
 		},
 		{
 			"backup and hot-restart uuids are different",
@@ -58,6 +65,20 @@ func TestCopyBackupPVC(t *testing.T) {
 			},
 			"00000000-0000-0000-0000-000000000001",
 			false,
+			0,
+		},
+		{
+			"multiple backups selected by member id",
+			[]fileutil.File{
+				{Name: "00000000-0000-0000-0000-000000000001", IsDir: true},
+				{Name: "00000000-0000-0000-0000-000000000002", IsDir: true},
+			},
+			[]fileutil.File{
+				{Name: "00000000-0000-0000-0000-000000000001", IsDir: true},
+			},
+			"00000000-0000-0000-0000-000000000002",
+			false,
+			1,
 		},
 		{
 			"member ID is out of index error",
@@ -71,6 +92,7 @@ func TestCopyBackupPVC(t *testing.T) {
 			},
 			"",
 			true,
+			2,
 		},
 		{
 			"multiple hot restart folders",
@@ -84,6 +106,7 @@ func TestCopyBackupPVC(t *testing.T) {
 			},
 			"00000000-0000-0000-0000-000000000003",
 			false,
+			0,
 		},
 	}
 	for _, tt := range tests {
@@ -106,7 +129,7 @@ func TestCopyBackupPVC(t *testing.T) {
 			require.Nil(t, err)
 
 			//test
-			err = copyBackupPVC(backupDir, destDir)
+			_, _, err = copyBackupPVC(backupDir, tt.id, destDir, copyModeAuto)
 			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
 			if err != nil {
 				return
@@ -120,3 +143,220 @@ func TestCopyBackupPVC(t *testing.T) {
 		})
 	}
 }
+
+func TestCopyBackupPVC_Hardlink(t *testing.T) {
+	tests := []struct {
+		name     string
+		uploaded bool
+		wantSame bool
+	}{
+		{name: "backup not uploaded", uploaded: false, wantSame: false},
+		{name: "uploaded backup", uploaded: true, wantSame: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set up
+			tmpdir := t.TempDir()
+			backupDir := path.Join(tmpdir, "sequence")
+			require.Nil(t, fileutil.CreateFiles(backupDir, []fileutil.File{
+				{Name: newUUID, IsDir: true},
+				{Name: newUUID + "/cluster", IsDir: true},
+				{Name: newUUID + "/cluster/members.bin"},
+			}, true))
+			if tt.uploaded {
+				require.Nil(t, os.WriteFile(path.Join(backupDir, newUUID+".delete"), nil, 0600))
+			}
+			destDir := path.Join(tmpdir, "dest")
+
+			// Run test
+			_, used, err := copyBackupPVC(backupDir, 0, destDir, copyModeHardlink)
+			require.Nil(t, err)
+			require.Equal(t, tt.wantSame, used == copyModeHardlink)
+
+			srcInfo, err := os.Stat(path.Join(backupDir, newUUID, "cluster", "members.bin"))
+			require.Nil(t, err)
+			dstInfo, err := os.Stat(path.Join(destDir, newUUID, "cluster", "members.bin"))
+			require.Nil(t, err)
+			require.Equal(t, tt.wantSame, os.SameFile(srcInfo, dstInfo))
+		})
+	}
+}
+
+func TestCopier(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      copyMode
+		wantModes []copyMode
+		wantSame  bool
+	}{
+		{name: "hardlink", mode: copyModeHardlink, wantModes: []copyMode{copyModeHardlink}, wantSame: true},
+		{name: "copy", mode: copyModeCopy, wantModes: []copyMode{copyModeCopy}},
+		// reflinks fall back to copies on filesystems without clones, e.g. tmpfs
+		{name: "reflink", mode: copyModeReflink, wantModes: []copyMode{copyModeReflink, copyModeCopy}},
+		{name: "auto", mode: copyModeAuto, wantModes: []copyMode{copyModeReflink, copyModeCopy}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set up
+			tmpdir := t.TempDir()
+			src := path.Join(tmpdir, "src")
+			require.Nil(t, os.MkdirAll(path.Join(src, "cluster"), 0700))
+			require.Nil(t, os.WriteFile(path.Join(src, "cluster", "members.bin"), []byte("members"), 0640))
+			dst := path.Join(tmpdir, "dst")
+
+			// Run test
+			c := newCopier(tt.mode)
+			require.Nil(t, c.copyDir(src, dst))
+			require.Contains(t, tt.wantModes, c.used())
+
+			got, err := os.ReadFile(path.Join(dst, "cluster", "members.bin"))
+			require.Nil(t, err)
+			require.Equal(t, "members", string(got))
+			srcInfo, err := os.Stat(path.Join(src, "cluster", "members.bin"))
+			require.Nil(t, err)
+			dstInfo, err := os.Stat(path.Join(dst, "cluster", "members.bin"))
+			require.Nil(t, err)
+			require.Equal(t, srcInfo.Mode(), dstInfo.Mode())
+			require.Equal(t, tt.wantSame, os.SameFile(srcInfo, dstInfo))
+		})
+	}
+}
+
+func TestParseCopyMode(t *testing.T) {
+	mode, err := parseCopyMode("")
+	require.Nil(t, err)
+	require.Equal(t, copyModeAuto, mode)
+
+	mode, err = parseCopyMode("hardlink")
+	require.Nil(t, err)
+	require.Equal(t, copyModeHardlink, mode)
+
+	_, err = parseCopyMode("symlink")
+	require.EqualError(t, err, `invalid copy mode "symlink", expected one of auto, hardlink, reflink or copy`)
+}
+
+func TestLocalSequence(t *testing.T) {
+	tests := []struct {
+		name            string
+		files           []fileutil.File
+		sequence        string
+		id              int
+		includeUploaded bool
+		want            string
+		wantErr         string
+	}{
+		{
+			name: "newest sequence",
+			files: []fileutil.File{
+				{Name: "backup-1659034855438", IsDir: true},
+				{Name: "backup-1659034855438/" + oldUUID, IsDir: true},
+				{Name: "backup-1659034966542", IsDir: true},
+				{Name: "backup-1659034966542/" + newUUID, IsDir: true},
+			},
+			want: "backup-1659034966542",
+		},
+		{
+			name: "explicit sequence",
+			files: []fileutil.File{
+				{Name: "backup-1659034855438", IsDir: true},
+				{Name: "backup-1659034966542", IsDir: true},
+			},
+			sequence: "backup-1659034855438",
+			want:     "backup-1659034855438",
+		},
+		{
+			name: "skips sequences marked to be deleted and without backups",
+			files: []fileutil.File{
+				{Name: "backup-1659034855438", IsDir: true},
+				{Name: "backup-1659034855438/" + oldUUID, IsDir: true},
+				{Name: "backup-1659034966542", IsDir: true},
+				{Name: "backup-1659034966542/" + newUUID, IsDir: true},
+				{Name: "backup-1659034966542/" + newUUID + ".delete"},
+				{Name: "backup-1659035077000", IsDir: true},
+			},
+			want: "backup-1659034855438",
+		},
+		{
+			name: "includes sequences marked to be deleted",
+			files: []fileutil.File{
+				{Name: "backup-1659034855438", IsDir: true},
+				{Name: "backup-1659034855438/" + oldUUID, IsDir: true},
+				{Name: "backup-1659034966542", IsDir: true},
+				{Name: "backup-1659034966542/" + newUUID, IsDir: true},
+				{Name: "backup-1659034966542/" + newUUID + ".delete"},
+			},
+			includeUploaded: true,
+			want:            "backup-1659034966542",
+		},
+		{
+			name: "skips sequences without a backup of the member",
+			files: []fileutil.File{
+				{Name: "backup-1659034855438", IsDir: true},
+				{Name: "backup-1659034855438/00000000-0000-0000-0000-000000000001", IsDir: true},
+				{Name: "backup-1659034855438/00000000-0000-0000-0000-000000000002", IsDir: true},
+				{Name: "backup-1659034966542", IsDir: true},
+				{Name: "backup-1659034966542/00000000-0000-0000-0000-000000000001", IsDir: true},
+				{Name: "backup-1659034966542/00000000-0000-0000-0000-000000000003", IsDir: true},
+				{Name: "backup-1659034966542/00000000-0000-0000-0000-000000000003.delete"},
+			},
+			id:   1,
+			want: "backup-1659034855438",
+		},
+		{
+			name: "no valid sequence",
+			files: []fileutil.File{
+				{Name: "backup-1659034855438", IsDir: true},
+				{Name: "backup-1659034855438/" + oldUUID, IsDir: true},
+				{Name: "backup-1659034855438/" + oldUUID + ".delete"},
+			},
+			wantErr: "there is no backup sequence of member 0 in",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set up
+			dir := t.TempDir()
+			require.Nil(t, fileutil.CreateFiles(dir, tt.files, true))
+
+			// Run test
+			got, err := localSequence(dir, tt.sequence, tt.id, tt.includeUploaded)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, path.Join(dir, tt.want), got)
+		})
+	}
+}
+
+func TestLocalInPVCCmd_Hardlink(t *testing.T) {
+	// Set up
+	tmpdir := t.TempDir()
+	seqDir := path.Join(tmpdir, "hot-backup", "backup-1659034966542")
+	require.Nil(t, fileutil.CreateFiles(seqDir, []fileutil.File{
+		{Name: newUUID, IsDir: true},
+		{Name: newUUID + "/cluster", IsDir: true},
+		{Name: newUUID + "/cluster/members.bin"},
+		{Name: newUUID + ".delete"},
+	}, true))
+	destDir := path.Join(tmpdir, "dest")
+
+	// Run test: the uploaded sequence is selected and linked
+	cmd := &LocalInPVCCmd{
+		BackupSourceBaseDir:      tmpdir,
+		BackupDestinationBaseDir: destDir,
+		BackupDir:                "hot-backup",
+		RestoreID:                "id",
+		CopyMode:                 string(copyModeHardlink),
+		Ordinal:                  "0",
+	}
+	require.Equal(t, subcommands.ExitSuccess, cmd.Execute(context.Background(), &flag.FlagSet{}))
+
+	// SameFile compares the device and the inode of the files
+	srcInfo, err := os.Stat(path.Join(seqDir, newUUID, "cluster", "members.bin"))
+	require.Nil(t, err)
+	dstInfo, err := os.Stat(path.Join(destDir, newUUID, "cluster", "members.bin"))
+	require.Nil(t, err)
+	require.True(t, os.SameFile(srcInfo, dstInfo))
+}
@@ -0,0 +1,89 @@
+package restore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hazelcast/platform-operator-agent/internal/version"
+)
+
+// lockRecord is the content of a restore lock file. Locks written by older agents are empty.
+type lockRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Source is the bucket URI or the local backup sequence folder
+	Source string `json:"source"`
+	// Key is the archive key or the local backup UUID directory
+	Key string `json:"key"`
+	// Checksum is the SHA-256 checksum of the downloaded archive, empty for local restores
+	Checksum     string `json:"checksum,omitempty"`
+	AgentVersion string `json:"agentVersion"`
+}
+
+func newLockRecord(source, key, checksum string) lockRecord {
+	return lockRecord{
+		Timestamp:    time.Now().UTC(),
+		Source:       source,
+		Key:          key,
+		Checksum:     checksum,
+		AgentVersion: version.Version,
+	}
+}
+
+// writeLock creates the lock file, replacing it atomically if it exists
+func writeLock(name string, rec lockRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// lockStatus is a restore lock found on a volume
+type lockStatus struct {
+	RestoreID string `json:"restoreID"`
+	Member    int    `json:"member"`
+	// Legacy is set for empty locks written by older agents, only the timestamp is known, from the file modification time
+	Legacy bool `json:"legacy,omitempty"`
+	lockRecord
+}
+
+// readLock reads the lock file with the given name, as created by lockFileName, in the directory
+func readLock(dir, name string) (lockStatus, error) {
+	parts := strings.Split(strings.TrimPrefix(name, "."+restoreLock+"."), ".")
+	if len(parts) != 2 {
+		return lockStatus{}, fmt.Errorf("invalid restore lock name %s", name)
+	}
+	member, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return lockStatus{}, fmt.Errorf("invalid restore lock name %s", name)
+	}
+	st := lockStatus{RestoreID: parts[0], Member: member}
+
+	p := filepath.Join(dir, name)
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return lockStatus{}, err
+	}
+	if len(data) == 0 {
+		info, err := os.Stat(p)
+		if err != nil {
+			return lockStatus{}, err
+		}
+		st.Legacy = true
+		st.Timestamp = info.ModTime().UTC()
+		return st, nil
+	}
+	if err = json.Unmarshal(data, &st.lockRecord); err != nil {
+		return lockStatus{}, fmt.Errorf("invalid restore lock %s: %w", name, err)
+	}
+	return st, nil
+}
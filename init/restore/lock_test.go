@@ -0,0 +1,63 @@
+package restore
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreHistory(t *testing.T) {
+	// Set up
+	dir := t.TempDir()
+	legacy := path.Join(dir, lockFileName("old", 0))
+	require.Nil(t, os.WriteFile(legacy, []byte{}, 0600))
+	legacyTime := time.Date(2022, 7, 29, 0, 10, 0, 0, time.UTC)
+	require.Nil(t, os.Chtimes(legacy, legacyTime, legacyTime))
+
+	rec := newLockRecord("s3://bucket", "2006-01-02-15-04-05/"+newUUID+".tar.gz", "sha256:abc")
+	require.Nil(t, writeLock(path.Join(dir, lockFileName("new", 1)), rec))
+	require.Nil(t, os.WriteFile(path.Join(dir, "other-file"), []byte("other"), 0600))
+
+	// Run test
+	history, err := restoreHistory(dir)
+	require.Nil(t, err)
+	require.Equal(t, []lockStatus{
+		{RestoreID: "old", Member: 0, Legacy: true, lockRecord: lockRecord{Timestamp: legacyTime}},
+		{RestoreID: "new", Member: 1, lockRecord: rec},
+	}, history)
+
+	var out bytes.Buffer
+	require.Nil(t, printStatus(&out, dir, false))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	require.Equal(t, []string{"2022-07-29T00:10:00Z", "0", "old", "-", "-", "-", "-"}, strings.Fields(lines[1]))
+	require.Equal(t, []string{rec.Timestamp.Format(time.RFC3339), "1", "new", "s3://bucket", rec.Key, "sha256:abc", "dev"}, strings.Fields(lines[2]))
+
+	out.Reset()
+	require.Nil(t, printStatus(&out, dir, true))
+	var got []lockStatus
+	require.Nil(t, json.Unmarshal(out.Bytes(), &got))
+	require.Len(t, got, 2)
+	require.Equal(t, "s3://bucket", got[1].Source)
+}
+
+func TestCleanupLocks(t *testing.T) {
+	// Set up
+	dir := t.TempDir()
+	require.Nil(t, os.WriteFile(path.Join(dir, lockFileName("old", 1)), []byte{}, 0600))
+	require.Nil(t, writeLock(path.Join(dir, lockFileName("new", 1)), newLockRecord("src", "key", "")))
+	require.Nil(t, writeLock(path.Join(dir, lockFileName("new", 2)), newLockRecord("src", "key", "")))
+
+	// Run test
+	require.Nil(t, cleanupLocks(dir, 1))
+	locks, err := getLocks(dir)
+	require.Nil(t, err)
+	require.Len(t, locks, 1)
+	require.Equal(t, lockFileName("new", 2), locks[0].Name())
+}
@@ -0,0 +1,63 @@
+package restore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/internal/k8s"
+)
+
+// memberOrdinal resolves the member index, trying in order the override, the pod-index label of the Pod and
+// the StatefulSet hostname. The pod-index label is read from the POD_INDEX environment variable, the downward API
+// labels file or the Kubernetes API.
+func memberOrdinal(ctx context.Context, override string, l *zap.Logger) (int, error) {
+	id, source, err := resolveOrdinal(ctx, override, l)
+	if err != nil {
+		return 0, err
+	}
+	l.Info("member ordinal resolved", zap.Int("ordinal", id), zap.String("source", source))
+	return id, nil
+}
+
+func resolveOrdinal(ctx context.Context, override string, l *zap.Logger) (int, string, error) {
+	if override != "" {
+		id, err := parseOrdinal(override)
+		return id, "override", err
+	}
+
+	if v := os.Getenv(k8s.PodIndexEnv); v != "" {
+		id, err := parseOrdinal(v)
+		return id, "downward API environment variable " + k8s.PodIndexEnv, err
+	}
+
+	v, source, err := k8s.PodLabel(ctx, k8s.PodIndexLabel)
+	if err == nil {
+		id, err := parseOrdinal(v)
+		return id, source, err
+	}
+	if !errors.Is(err, k8s.ErrUnknownPod) {
+		l.Info("could not read the pod-index label: " + err.Error())
+	}
+
+	// with setHostnameAsFQDN the hostname is the fully qualified domain name of the Pod
+	hostname, _, _ := strings.Cut(os.Getenv("HOSTNAME"), ".")
+	if !hostnameRE.MatchString(hostname) {
+		return 0, "", fmt.Errorf("could not resolve the member ordinal, hostname %q does not conform to statefulset naming scheme", hostname)
+	}
+	id, err := parseID(hostname)
+	return id, "hostname", err
+}
+
+func parseOrdinal(s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid member ordinal %q", s)
+	}
+	return id, nil
+}
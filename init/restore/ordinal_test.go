@@ -0,0 +1,78 @@
+package restore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/internal/k8s"
+)
+
+func TestResolveOrdinal(t *testing.T) {
+	tests := []struct {
+		name       string
+		override   string
+		podIndex   string
+		hostname   string
+		want       int
+		wantSource string
+		wantErr    string
+	}{
+		{
+			name:       "override",
+			override:   "3",
+			podIndex:   "2",
+			hostname:   "hz-1",
+			want:       3,
+			wantSource: "override",
+		},
+		{
+			name:       "pod-index label",
+			podIndex:   "2",
+			hostname:   "hz-1",
+			want:       2,
+			wantSource: "downward API environment variable POD_INDEX",
+		},
+		{
+			name:       "hostname",
+			hostname:   "hz-1",
+			want:       1,
+			wantSource: "hostname",
+		},
+		{
+			name:       "fully qualified hostname",
+			hostname:   "hz-12.hz.default.svc.cluster.local",
+			want:       12,
+			wantSource: "hostname",
+		},
+		{
+			name:     "invalid override",
+			override: "-1",
+			wantErr:  `invalid member ordinal "-1"`,
+		},
+		{
+			name:     "custom hostname",
+			hostname: "member",
+			wantErr:  `could not resolve the member ordinal, hostname "member" does not conform to statefulset naming scheme`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(k8s.PodIndexEnv, tt.podIndex)
+			t.Setenv(k8s.PodNameEnv, "")
+			t.Setenv("KUBERNETES_SERVICE_HOST", "")
+			t.Setenv("HOSTNAME", tt.hostname)
+
+			id, source, err := resolveOrdinal(context.Background(), tt.override, zap.NewNop())
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, tt.want, id)
+			require.Equal(t, tt.wantSource, source)
+		})
+	}
+}
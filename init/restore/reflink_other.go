@@ -0,0 +1,9 @@
+//go:build !linux
+
+package restore
+
+import "os"
+
+func reflink(*os.File, *os.File) error {
+	return errReflinkUnsupported
+}
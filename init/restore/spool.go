@@ -0,0 +1,324 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+
+	"github.com/hazelcast/platform-operator-agent/internal/verify"
+)
+
+const (
+	spoolDirName = ".restore-spool"
+
+	// progressInterval is the number of bytes downloaded between the progress updates
+	progressInterval = 64 << 20
+	spoolAttempts    = 5
+)
+
+// spoolRetryDelay is the delay before the first retry of a failed download, doubled for each retry
+var spoolRetryDelay = time.Second
+
+// archiveSource provides the archives to restore
+type archiveSource interface {
+	attributes(ctx context.Context, key string) (archiveAttributes, error)
+	// newRangeReader reads the archive starting from the offset
+	newRangeReader(ctx context.Context, key string, offset int64) (io.ReadCloser, error)
+}
+
+// archiveAttributes identify the archive content, MD5, SHA256 and ETag are optional
+type archiveAttributes struct {
+	Size int64  `json:"size"`
+	MD5  []byte `json:"md5,omitempty"`
+	// SHA256 is the hex digest of the companion checksum file or of the configuration
+	SHA256  string    `json:"sha256,omitempty"`
+	ETag    string    `json:"etag,omitempty"`
+	ModTime time.Time `json:"modTime"`
+}
+
+func (a archiveAttributes) equal(o archiveAttributes) bool {
+	return a.Size == o.Size && bytes.Equal(a.MD5, o.MD5) && a.SHA256 == o.SHA256 && a.ETag == o.ETag && a.ModTime.Equal(o.ModTime)
+}
+
+type bucketSource struct {
+	bucket *blob.Bucket
+}
+
+// attributes also reads the companion checksum file uploaded by the sidecar, archives of older agents have none
+func (s bucketSource) attributes(ctx context.Context, key string) (archiveAttributes, error) {
+	attrs, err := s.bucket.Attributes(ctx, key)
+	if err != nil {
+		return archiveAttributes{}, err
+	}
+	var digest string
+	data, err := s.bucket.ReadAll(ctx, key+verify.ChecksumSuffix)
+	switch {
+	case err == nil:
+		if digest, err = verify.ParseChecksumFile(data); err != nil {
+			return archiveAttributes{}, fmt.Errorf("invalid checksum file of %s: %w", key, err)
+		}
+	case gcerrors.Code(err) != gcerrors.NotFound:
+		return archiveAttributes{}, err
+	}
+	return archiveAttributes{
+		Size:    attrs.Size,
+		MD5:     attrs.MD5,
+		SHA256:  digest,
+		ETag:    attrs.ETag,
+		ModTime: attrs.ModTime,
+	}, nil
+}
+
+func (s bucketSource) newRangeReader(ctx context.Context, key string, offset int64) (io.ReadCloser, error) {
+	return s.bucket.NewRangeReader(ctx, key, offset, -1, nil)
+}
+
+// spoolProgress is persisted next to the spool file to resume the download after a restart
+type spoolProgress struct {
+	Key        string            `json:"key"`
+	Attributes archiveAttributes `json:"attributes"`
+	Offset     int64             `json:"offset"`
+}
+
+// spool is a local copy of an archive downloaded with ranged reads
+type spool struct {
+	src      archiveSource
+	key      string
+	path     string
+	progress spoolProgress
+	// digest is the hex SHA-256 digest of the verified download
+	digest string
+}
+
+// newSpool names the spool file by the hash of the key, keys such as URLs may exceed the maximum file name length
+func newSpool(src archiveSource, key, dir string) *spool {
+	sum := sha256.Sum256([]byte(key))
+	return &spool{
+		src:  src,
+		key:  key,
+		path: filepath.Join(dir, hex.EncodeToString(sum[:])+".tar.gz"),
+	}
+}
+
+func (s *spool) progressPath() string {
+	return s.path + ".progress"
+}
+
+// download downloads the archive into the spool file, resuming a previous download of the same archive.
+// The size and, if known, the MD5 checksum of the downloaded file are verified.
+func (s *spool) download(ctx context.Context) error {
+	attrs, err := s.src.attributes(ctx, s.key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	if err = s.removeOthers(); err != nil {
+		return err
+	}
+
+	offset := s.resumeOffset(attrs)
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = f.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	s.progress = spoolProgress{Key: s.key, Attributes: attrs, Offset: offset}
+	if err = s.saveProgress(); err != nil {
+		return err
+	}
+	if offset > 0 {
+		log.Info("resuming download", zap.String("key", s.key), zap.Int64("offset", offset), zap.Int64("size", attrs.Size))
+	}
+
+	delay := spoolRetryDelay
+	for attempt := 1; s.progress.Offset < attrs.Size; attempt++ {
+		err = s.copyRange(ctx, f)
+		if err == nil && s.progress.Offset < attrs.Size {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil {
+			break
+		}
+		if attempt == spoolAttempts || ctx.Err() != nil {
+			return fmt.Errorf("download of %s failed at offset %d: %w", s.key, s.progress.Offset, err)
+		}
+		log.Warn("download interrupted, retrying: "+err.Error(), zap.String("key", s.key), zap.Int64("offset", s.progress.Offset))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if s.digest, err = s.verify(); err != nil {
+		s.remove()
+		return err
+	}
+	return nil
+}
+
+// removeOthers removes the spool files of other archives, left behind by interrupted restores
+func (s *spool) removeOthers() error {
+	entries, err := os.ReadDir(filepath.Dir(s.path))
+	if err != nil {
+		return err
+	}
+	keep := map[string]bool{filepath.Base(s.path): true, filepath.Base(s.progressPath()): true}
+	for _, e := range entries {
+		if keep[e.Name()] {
+			continue
+		}
+		log.Info("removing a stale spool file", zap.String("file", e.Name()))
+		if err = os.RemoveAll(filepath.Join(filepath.Dir(s.path), e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resumeOffset returns the offset of a previous download of the same archive, 0 otherwise
+func (s *spool) resumeOffset(attrs archiveAttributes) int64 {
+	data, err := os.ReadFile(s.progressPath())
+	if err != nil {
+		return 0
+	}
+	var p spoolProgress
+	if err = json.Unmarshal(data, &p); err != nil || p.Key != s.key || !p.Attributes.equal(attrs) {
+		return 0
+	}
+	info, err := os.Stat(s.path)
+	if err != nil || info.Size() < p.Offset || p.Offset > attrs.Size {
+		return 0
+	}
+	return p.Offset
+}
+
+// copyRange appends the archive from the current offset to the spool file
+func (s *spool) copyRange(ctx context.Context, f *os.File) error {
+	r, err := s.src.newRangeReader(ctx, s.key, s.progress.Offset)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	buf := make([]byte, 1<<20)
+	var unsaved int64
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, wErr := f.Write(buf[:n]); wErr != nil {
+				return wErr
+			}
+			s.progress.Offset += int64(n)
+			unsaved += int64(n)
+			if unsaved >= progressInterval {
+				if err := s.sync(f); err != nil {
+					return err
+				}
+				unsaved = 0
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return s.sync(f)
+		}
+		if err != nil {
+			if syncErr := s.sync(f); syncErr != nil {
+				return syncErr
+			}
+			return err
+		}
+	}
+}
+
+// sync flushes the spool file before recording its offset
+func (s *spool) sync(f *os.File) error {
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return s.saveProgress()
+}
+
+func (s *spool) saveProgress() error {
+	data, err := json.Marshal(s.progress)
+	if err != nil {
+		return err
+	}
+	tmp := s.progressPath() + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.progressPath())
+}
+
+// verify checks the size and the known checksums of the downloaded archive before it is extracted.
+// It returns the hex SHA-256 digest of the archive.
+func (s *spool) verify() (string, error) {
+	attrs := s.progress.Attributes
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() != attrs.Size {
+		return "", fmt.Errorf("downloaded size of %s is %d bytes, expected %d", s.key, info.Size(), attrs.Size)
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	if _, err = io.Copy(io.MultiWriter(md5Hash, sha256Hash), f); err != nil {
+		return "", err
+	}
+	digest := hex.EncodeToString(sha256Hash.Sum(nil))
+
+	if len(attrs.MD5) > 0 {
+		if sum := md5Hash.Sum(nil); !bytes.Equal(sum, attrs.MD5) {
+			return "", fmt.Errorf("MD5 checksum of %s is %s, expected %s", s.key, hex.EncodeToString(sum), hex.EncodeToString(attrs.MD5))
+		}
+	}
+	if attrs.SHA256 != "" && digest != attrs.SHA256 {
+		return "", fmt.Errorf("SHA-256 digest of %s is %s, expected %s", s.key, digest, attrs.SHA256)
+	}
+	if len(attrs.MD5) == 0 && attrs.SHA256 == "" {
+		log.Warn("the archive has no checksum to verify, only its size was checked", zap.String("key", s.key), zap.String("sha256", digest))
+	}
+	return digest, nil
+}
+
+// remove deletes the spool and progress files, and the spool directory if it is empty
+func (s *spool) remove() {
+	for _, name := range []string{s.path, s.progressPath()} {
+		if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Warn("could not remove the spool file: "+err.Error(), zap.String("file", name))
+		}
+	}
+	_ = os.Remove(filepath.Dir(s.path))
+}
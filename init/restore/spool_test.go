@@ -0,0 +1,250 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+)
+
+// flakySource serves content and fails each read after failAfter bytes
+type flakySource struct {
+	content   []byte
+	attrs     archiveAttributes
+	failAfter int
+	offsets   []int64
+}
+
+func newFlakySource(content []byte, failAfter int) *flakySource {
+	sum := md5.Sum(content)
+	return &flakySource{
+		content:   content,
+		attrs:     archiveAttributes{Size: int64(len(content)), MD5: sum[:], ETag: "etag"},
+		failAfter: failAfter,
+	}
+}
+
+func (s *flakySource) attributes(context.Context, string) (archiveAttributes, error) {
+	return s.attrs, nil
+}
+
+func (s *flakySource) newRangeReader(_ context.Context, _ string, offset int64) (io.ReadCloser, error) {
+	s.offsets = append(s.offsets, offset)
+	r := io.Reader(bytes.NewReader(s.content[offset:]))
+	if s.failAfter > 0 {
+		r = io.MultiReader(io.LimitReader(r, int64(s.failAfter)), errReader{})
+	}
+	return io.NopCloser(r), nil
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset by peer")
+}
+
+func TestSpool(t *testing.T) {
+	defer func(d time.Duration) { spoolRetryDelay = d }(spoolRetryDelay)
+	spoolRetryDelay = time.Millisecond
+	content := bytes.Repeat([]byte("0123456789"), 10)
+
+	tests := []struct {
+		name        string
+		failAfter   int
+		previous    []byte
+		progress    *spoolProgress
+		wantOffsets []int64
+		wantErr     string
+	}{
+		{
+			name:        "single read",
+			wantOffsets: []int64{0},
+		},
+		{
+			name:        "retries from the last offset",
+			failAfter:   30,
+			wantOffsets: []int64{0, 30, 60, 90},
+		},
+		{
+			name:        "too many failures",
+			failAfter:   10,
+			wantOffsets: []int64{0, 10, 20, 30, 40},
+			wantErr:     "download of key failed at offset 50: connection reset by peer",
+		},
+		{
+			name:        "resumes a previous download",
+			previous:    content[:42],
+			progress:    &spoolProgress{Key: "key", Offset: 40},
+			wantOffsets: []int64{40},
+		},
+		{
+			name:        "restarts a download of another archive",
+			previous:    content[:42],
+			progress:    &spoolProgress{Key: "key", Offset: 40, Attributes: archiveAttributes{Size: 100, ETag: "other"}},
+			wantOffsets: []int64{0},
+		},
+		{
+			name:        "restarts if the spool file is shorter than the progress",
+			previous:    content[:20],
+			progress:    &spoolProgress{Key: "key", Offset: 40},
+			wantOffsets: []int64{0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set up
+			src := newFlakySource(content, tt.failAfter)
+			sp := newSpool(src, "key", t.TempDir())
+			if tt.previous != nil {
+				require.Nil(t, os.WriteFile(sp.path, tt.previous, 0600))
+				if tt.progress.Attributes.Size == 0 {
+					tt.progress.Attributes = src.attrs
+				}
+				data, err := json.Marshal(tt.progress)
+				require.Nil(t, err)
+				require.Nil(t, os.WriteFile(sp.progressPath(), data, 0600))
+			}
+
+			// Run test
+			err := sp.download(context.Background())
+			require.Equal(t, tt.wantOffsets, src.offsets)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				// the progress is kept for the next attempt
+				data, err := os.ReadFile(sp.progressPath())
+				require.Nil(t, err)
+				var p spoolProgress
+				require.Nil(t, json.Unmarshal(data, &p))
+				require.Equal(t, int64(50), p.Offset)
+				return
+			}
+			require.Nil(t, err)
+			got, err := os.ReadFile(sp.path)
+			require.Nil(t, err)
+			require.Equal(t, content, got)
+		})
+	}
+}
+
+func TestSpool_Verify(t *testing.T) {
+	content := []byte("archive content")
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		src := newFlakySource(content, 0)
+		src.attrs.MD5 = make([]byte, md5.Size)
+		sp := newSpool(src, "dir/key", t.TempDir())
+
+		err := sp.download(context.Background())
+		require.ErrorContains(t, err, "MD5 checksum of dir/key is")
+		require.NoFileExists(t, sp.path)
+		require.NoFileExists(t, sp.progressPath())
+	})
+
+	t.Run("SHA-256 mismatch", func(t *testing.T) {
+		src := newFlakySource(content, 0)
+		src.attrs.MD5 = nil
+		src.attrs.SHA256 = hex.EncodeToString(make([]byte, sha256.Size))
+		sp := newSpool(src, "key", t.TempDir())
+
+		err := sp.download(context.Background())
+		require.ErrorContains(t, err, "SHA-256 digest of key is")
+		require.NoFileExists(t, sp.path)
+	})
+
+	t.Run("no checksum", func(t *testing.T) {
+		src := newFlakySource(content, 0)
+		src.attrs.MD5 = nil
+		sp := newSpool(src, "key", t.TempDir())
+
+		require.Nil(t, sp.download(context.Background()))
+		sum := sha256.Sum256(content)
+		require.Equal(t, hex.EncodeToString(sum[:]), sp.digest)
+	})
+
+	t.Run("size mismatch", func(t *testing.T) {
+		src := newFlakySource(content, 0)
+		src.content = append(src.content, "trailing"...)
+		sp := newSpool(src, "key", t.TempDir())
+
+		err := sp.download(context.Background())
+		require.EqualError(t, err, "downloaded size of key is 23 bytes, expected 15")
+		require.NoFileExists(t, sp.path)
+	})
+}
+
+func TestSaveFromArchive_RemovesSpool(t *testing.T) {
+	ctx := context.Background()
+	tmpdir := t.TempDir()
+	archiveDir := path.Join(tmpdir, "archive")
+	require.Nil(t, os.MkdirAll(path.Join(archiveDir, newUUID), 0755))
+	archive := path.Join(tmpdir, "archive.tar.gz")
+	require.Nil(t, createArchiveFile(path.Join(archiveDir, newUUID), newUUID, archive))
+	data, err := os.ReadFile(archive)
+	require.Nil(t, err)
+
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	require.Nil(t, bucket.WriteAll(ctx, "backup/archive.tar.gz", data, nil))
+
+	spoolDir := path.Join(tmpdir, spoolDirName)
+	target := path.Join(tmpdir, "target")
+	checksum, err := saveFromArchive(ctx, bucketSource{bucket}, "backup/archive.tar.gz", spoolDir, target, 0)
+	require.Nil(t, err)
+	sum := sha256.Sum256(data)
+	require.Equal(t, "sha256:"+hex.EncodeToString(sum[:]), checksum)
+	require.DirExists(t, path.Join(target, newUUID))
+	require.NoDirExists(t, spoolDir)
+}
+
+func TestSaveFromArchive_VerifiesBeforeExtraction(t *testing.T) {
+	// Set up: an archive of the expected size and MD5, but another SHA-256 digest in the checksum file
+	ctx := context.Background()
+	tmpdir := t.TempDir()
+	archiveDir := path.Join(tmpdir, "archive")
+	require.Nil(t, os.MkdirAll(path.Join(archiveDir, newUUID), 0755))
+	archive := path.Join(tmpdir, "archive.tar.gz")
+	require.Nil(t, createArchiveFile(path.Join(archiveDir, newUUID), newUUID, archive))
+	data, err := os.ReadFile(archive)
+	require.Nil(t, err)
+
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+	require.Nil(t, bucket.WriteAll(ctx, "backup/archive.tar.gz", data, nil))
+	other := sha256.Sum256([]byte("other"))
+	require.Nil(t, bucket.WriteAll(ctx, "backup/archive.tar.gz.sha256", []byte(hex.EncodeToString(other[:])+"  archive.tar.gz\n"), nil))
+
+	// Run test
+	target := path.Join(tmpdir, "target")
+	_, err = saveFromArchive(ctx, bucketSource{bucket}, "backup/archive.tar.gz", path.Join(tmpdir, spoolDirName), target, 0)
+	require.ErrorContains(t, err, "SHA-256 digest of backup/archive.tar.gz is")
+	require.NoDirExists(t, target)
+}
+
+func TestSpool_Path(t *testing.T) {
+	// Set up: a long URL key and the spool file of another archive
+	dir := t.TempDir()
+	stale := newSpool(nil, "other", dir)
+	require.Nil(t, os.WriteFile(stale.path, []byte("partial"), 0600))
+	require.Nil(t, os.WriteFile(stale.progressPath(), []byte("{}"), 0600))
+
+	content := []byte("archive content")
+	key := "https://artifacts.example.com/" + strings.Repeat("backups/", 40) + "member-0.tar.gz"
+	sp := newSpool(newFlakySource(content, 0), key, dir)
+
+	// Run test
+	require.Nil(t, sp.download(context.Background()))
+	require.Less(t, len(path.Base(sp.path)), 255)
+	require.Equal(t, []string{path.Base(sp.path), path.Base(sp.progressPath())}, dirNames(t, dir))
+}
@@ -0,0 +1,219 @@
+package restore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+const (
+	stagingDirPrefix  = ".restore-staging-"
+	previousDirPrefix = ".restore-previous-"
+	// swapFile in the previous directory names the staged directory, it is written before the swap starts
+	swapFile = ".swap"
+	// committedFile in the previous directory marks that the staged directory was moved in
+	committedFile = ".committed"
+)
+
+// stage is a staging directory on the destination volume. The restored hot-restart data is
+// written into the stage and swapped with the existing data only after it is complete.
+type stage struct {
+	dst string
+	dir string
+	// uuid is the expected hot-restart UUID of the staged data, any UUID is accepted if empty
+	uuid string
+}
+
+// newStage creates a staging directory in dst. The swap of an interrupted restore is completed if the staged
+// data was already moved in, otherwise the previous data is moved back.
+func newStage(dst string) (*stage, error) {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return nil, err
+	}
+	if err := recoverStages(dst); err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(dst, stagingDirPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return &stage{dst: dst, dir: dir}, nil
+}
+
+// commit replaces the hot-restart UUID directories in dst with the staged one.
+// On failure the previous directories are restored.
+func (s *stage) commit() error {
+	staged, err := s.verify()
+	if err != nil {
+		return err
+	}
+
+	current, err := fileutil.FolderUUIDs(s.dst)
+	if err != nil {
+		return err
+	}
+
+	previous, err := os.MkdirTemp(s.dst, previousDirPrefix)
+	if err != nil {
+		return err
+	}
+	// recoverStages finds the staged directory by this file, if the swap is interrupted
+	swap := filepath.Join(filepath.Base(s.dir), staged)
+	if err = os.WriteFile(filepath.Join(previous, swapFile), []byte(swap), 0600); err != nil {
+		_ = os.RemoveAll(previous)
+		return err
+	}
+
+	var moved []string
+	rollback := func(err error) error {
+		for _, name := range moved {
+			if rbErr := os.Rename(filepath.Join(previous, name), filepath.Join(s.dst, name)); rbErr != nil {
+				return fmt.Errorf("%w, rollback of %s failed: %v", err, name, rbErr)
+			}
+		}
+		if rbErr := os.Remove(filepath.Join(previous, swapFile)); rbErr != nil {
+			return fmt.Errorf("%w, rollback failed: %v", err, rbErr)
+		}
+		if rbErr := os.Remove(previous); rbErr != nil {
+			return fmt.Errorf("%w, rollback failed: %v", err, rbErr)
+		}
+		return err
+	}
+
+	for _, uuid := range current {
+		if err = os.Rename(filepath.Join(s.dst, uuid.Name()), filepath.Join(previous, uuid.Name())); err != nil {
+			return rollback(err)
+		}
+		moved = append(moved, uuid.Name())
+	}
+
+	if err = os.Rename(filepath.Join(s.dir, staged), filepath.Join(s.dst, staged)); err != nil {
+		return rollback(err)
+	}
+	if err = os.WriteFile(filepath.Join(previous, committedFile), nil, 0600); err != nil {
+		// recoverStages finds the staged directory moved in without the marker too
+		log.Warn("could not mark the swap as committed: "+err.Error(), zap.String("dir", previous))
+	}
+
+	// the new data is in place, failing to remove the previous one does not fail the restore
+	if err = os.RemoveAll(previous); err != nil {
+		log.Warn("could not remove the previous hot-restart data: "+err.Error(), zap.String("dir", previous))
+	}
+	return nil
+}
+
+// verify checks that the stage holds exactly one hot-restart UUID directory and returns its name
+func (s *stage) verify() (string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) != 1 || !entries[0].IsDir() || !fileutil.UUIDRegex.MatchString(entries[0].Name()) {
+		names := make([]string, 0, len(entries))
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return "", fmt.Errorf("restored data must be a single hot-restart UUID directory, got: %s", strings.Join(names, ", "))
+	}
+	if s.uuid != "" && entries[0].Name() != s.uuid {
+		return "", fmt.Errorf("restored hot-restart directory %s does not match the member UUID %s of the archive", entries[0].Name(), s.uuid)
+	}
+	return entries[0].Name(), nil
+}
+
+// cleanup removes the staging directory, it is a no-op after a successful commit
+func (s *stage) cleanup() {
+	if err := os.RemoveAll(s.dir); err != nil {
+		log.Warn("could not remove the staging directory: "+err.Error(), zap.String("dir", s.dir))
+	}
+}
+
+// recoverStages completes or rolls back the swaps of interrupted restores and removes their staging directories.
+// A swap is rolled back by moving every entry of the previous directory back, unless the staged directory was
+// already moved in.
+func recoverStages(dst string) error {
+	entries, err := os.ReadDir(dst)
+	if err != nil {
+		return err
+	}
+
+	// the staging directories show whether the staged data was moved in, they are removed last
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), previousDirPrefix) {
+			continue
+		}
+		dir := filepath.Join(dst, e.Name())
+		committed, err := swapCommitted(dst, dir)
+		if err != nil {
+			return err
+		}
+		if !committed {
+			if err = rollbackSwap(dst, dir); err != nil {
+				return err
+			}
+		}
+		if err = os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), stagingDirPrefix) {
+			continue
+		}
+		if err = os.RemoveAll(filepath.Join(dst, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// swapCommitted reports whether the staged directory of the interrupted swap was moved into dst
+func swapCommitted(dst, previous string) (bool, error) {
+	if _, err := os.Stat(filepath.Join(previous, committedFile)); err == nil {
+		return true, nil
+	}
+	data, err := os.ReadFile(filepath.Join(previous, swapFile))
+	if os.IsNotExist(err) {
+		// the swap did not start
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	swap := string(data)
+	if !filepath.IsLocal(swap) {
+		return false, fmt.Errorf("invalid swap file in %s: %q", previous, swap)
+	}
+	// the staged directory is still in the staging directory until it is moved in
+	if _, err = os.Stat(filepath.Join(dst, swap)); err == nil {
+		return false, nil
+	}
+	_, err = os.Stat(filepath.Join(dst, filepath.Base(swap)))
+	return err == nil, nil
+}
+
+// rollbackSwap moves the entries of the previous directory back to dst
+func rollbackSwap(dst, previous string) error {
+	entries, err := os.ReadDir(previous)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() == swapFile || e.Name() == committedFile {
+			continue
+		}
+		if err = os.Rename(filepath.Join(previous, e.Name()), filepath.Join(dst, e.Name())); err != nil {
+			return err
+		}
+		log.Info("recovered hot-restart data of an interrupted restore", zap.String("uuid", e.Name()))
+	}
+	return nil
+}
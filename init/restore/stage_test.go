@@ -0,0 +1,211 @@
+package restore
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+)
+
+const (
+	oldUUID = "00000000-0000-0000-0000-00000000000a"
+	newUUID = "00000000-0000-0000-0000-000000000001"
+)
+
+func dirNames(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestStage(t *testing.T) {
+	tests := []struct {
+		name    string
+		staged  []fileutil.File
+		want    []string
+		wantErr bool
+	}{
+		{
+			"swap",
+			[]fileutil.File{{Name: newUUID, IsDir: true}, {Name: newUUID + "/file"}},
+			[]string{newUUID},
+			false,
+		},
+		{
+			"same uuid",
+			[]fileutil.File{{Name: oldUUID, IsDir: true}, {Name: oldUUID + "/new-file"}},
+			[]string{oldUUID},
+			false,
+		},
+		{
+			"empty stage",
+			[]fileutil.File{},
+			[]string{oldUUID},
+			true,
+		},
+		{
+			"multiple uuids",
+			[]fileutil.File{{Name: newUUID, IsDir: true}, {Name: "00000000-0000-0000-0000-000000000002", IsDir: true}},
+			[]string{oldUUID},
+			true,
+		},
+		{
+			"not a uuid",
+			[]fileutil.File{{Name: "cluster", IsDir: true}},
+			[]string{oldUUID},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set up
+			dst := t.TempDir()
+			require.Nil(t, fileutil.CreateFiles(dst, []fileutil.File{{Name: oldUUID, IsDir: true}, {Name: oldUUID + "/old-file"}}, false))
+
+			st, err := newStage(dst)
+			require.Nil(t, err)
+			require.Nil(t, fileutil.CreateFiles(st.dir, tt.staged, false))
+
+			// Run test
+			err = st.commit()
+			st.cleanup()
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+			require.Equal(t, tt.want, dirNames(t, dst))
+			if err != nil {
+				require.FileExists(t, path.Join(dst, oldUUID, "old-file"))
+				return
+			}
+			require.ElementsMatch(t, tt.staged, mustDirFileList(t, dst))
+		})
+	}
+}
+
+func mustDirFileList(t *testing.T, dir string) []fileutil.File {
+	files, err := fileutil.DirFileList(dir)
+	require.Nil(t, err)
+	return files
+}
+
+func TestStage_FailedDownloadKeepsData(t *testing.T) {
+	// Set up
+	tmpdir := t.TempDir()
+	dst := path.Join(tmpdir, "dest")
+	require.Nil(t, fileutil.CreateFiles(dst, []fileutil.File{{Name: oldUUID, IsDir: true}, {Name: oldUUID + "/old-file"}}, true))
+	bucketPath := path.Join(tmpdir, "bucket")
+	require.Nil(t, os.MkdirAll(bucketPath, 0755))
+	require.Nil(t, os.WriteFile(path.Join(bucketPath, newUUID+".tar.gz"), []byte("corrupted"), 0644))
+
+	// Run test
+	_, _, err := downloadFromBucketToPvc(context.Background(), "file://"+bucketPath, dst, 0, "", backupSelector{}, 0)
+	require.NotNil(t, err)
+	require.Equal(t, []string{oldUUID}, dirNames(t, dst))
+	require.FileExists(t, path.Join(dst, oldUUID, "old-file"))
+}
+
+func TestNewStage_RecoversInterruptedSwap(t *testing.T) {
+	// Set up: the previous data was moved away, but the staged one was not moved in yet
+	dst := t.TempDir()
+	require.Nil(t, fileutil.CreateFiles(dst, []fileutil.File{
+		{Name: previousDirPrefix + "1", IsDir: true},
+		{Name: previousDirPrefix + "1/" + oldUUID, IsDir: true},
+		{Name: previousDirPrefix + "1/" + oldUUID + "/old-file"},
+		{Name: stagingDirPrefix + "2", IsDir: true},
+		{Name: stagingDirPrefix + "2/" + newUUID, IsDir: true},
+	}, false))
+
+	// Run test
+	st, err := newStage(dst)
+	require.Nil(t, err)
+	defer st.cleanup()
+
+	require.ElementsMatch(t, []string{oldUUID, path.Base(st.dir)}, dirNames(t, dst))
+	require.FileExists(t, path.Join(dst, oldUUID, "old-file"))
+}
+
+func TestNewStage_RecoversInterruptedSwap_Partial(t *testing.T) {
+	const otherUUID = "00000000-0000-0000-0000-00000000000b"
+	tests := []struct {
+		name  string
+		files []fileutil.File
+		// swap is the staged directory named by the swap file
+		swap     string
+		want     []string
+		wantFile string
+	}{
+		{
+			name: "crash in the middle of the moves",
+			files: []fileutil.File{
+				{Name: otherUUID, IsDir: true},
+				{Name: previousDirPrefix + "1", IsDir: true},
+				{Name: previousDirPrefix + "1/" + oldUUID, IsDir: true},
+				{Name: previousDirPrefix + "1/" + oldUUID + "/old-file"},
+				{Name: stagingDirPrefix + "2", IsDir: true},
+				{Name: stagingDirPrefix + "2/" + newUUID, IsDir: true},
+			},
+			swap:     newUUID,
+			want:     []string{oldUUID, otherUUID},
+			wantFile: oldUUID + "/old-file",
+		},
+		{
+			name: "crash before the commit marker",
+			files: []fileutil.File{
+				{Name: newUUID, IsDir: true},
+				{Name: previousDirPrefix + "1", IsDir: true},
+				{Name: previousDirPrefix + "1/" + oldUUID, IsDir: true},
+				{Name: previousDirPrefix + "1/" + oldUUID + "/old-file"},
+				{Name: stagingDirPrefix + "2", IsDir: true},
+			},
+			swap: newUUID,
+			want: []string{newUUID},
+		},
+		{
+			name: "crash before the commit marker with the same uuid",
+			files: []fileutil.File{
+				{Name: oldUUID, IsDir: true},
+				{Name: oldUUID + "/new-file"},
+				{Name: previousDirPrefix + "1", IsDir: true},
+				{Name: previousDirPrefix + "1/" + oldUUID, IsDir: true},
+				{Name: previousDirPrefix + "1/" + oldUUID + "/old-file"},
+				{Name: stagingDirPrefix + "2", IsDir: true},
+			},
+			swap:     oldUUID,
+			want:     []string{oldUUID},
+			wantFile: oldUUID + "/new-file",
+		},
+		{
+			name: "committed",
+			files: []fileutil.File{
+				{Name: newUUID, IsDir: true},
+				{Name: previousDirPrefix + "1", IsDir: true},
+				{Name: previousDirPrefix + "1/" + committedFile},
+				{Name: previousDirPrefix + "1/" + oldUUID, IsDir: true},
+			},
+			swap: newUUID,
+			want: []string{newUUID},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set up
+			dst := t.TempDir()
+			require.Nil(t, fileutil.CreateFiles(dst, tt.files, false))
+			swap := path.Join(stagingDirPrefix+"2", tt.swap)
+			require.Nil(t, os.WriteFile(path.Join(dst, previousDirPrefix+"1", swapFile), []byte(swap), 0600))
+
+			// Run test
+			require.Nil(t, recoverStages(dst))
+			require.ElementsMatch(t, tt.want, dirNames(t, dst))
+			if tt.wantFile != "" {
+				require.FileExists(t, path.Join(dst, tt.wantFile))
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package restore
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/kelseyhightower/envconfig"
+
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+)
+
+var statusLog = logger.New().Named("restore_status")
+
+type StatusCmd struct {
+	Dir  string `envconfig:"RESTORE_STATUS_DIR"`
+	JSON bool   `envconfig:"RESTORE_STATUS_JSON"`
+}
+
+func (*StatusCmd) Name() string     { return "restore_status" }
+func (*StatusCmd) Synopsis() string { return "print the restore history of a volume" }
+func (*StatusCmd) Usage() string    { return "" }
+
+func (r *StatusCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&r.Dir, "dir", "/data/persistence/backup", "directory of the restore locks")
+	f.BoolVar(&r.JSON, "json", false, "print the restore history as JSON")
+}
+
+func (r *StatusCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	// overwrite config with environment variables
+	if err := envconfig.Process("restoreStatus", r); err != nil {
+		statusLog.Error("an error occurred while processing config from env: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
+	if err := printStatus(os.Stdout, r.Dir, r.JSON); err != nil {
+		statusLog.Error("could not read the restore locks: " + err.Error())
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// restoreHistory returns the restore locks in the directory, from the oldest to the newest
+func restoreHistory(dir string) ([]lockStatus, error) {
+	locks, err := getLocks(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]lockStatus, 0, len(locks))
+	for _, lock := range locks {
+		st, err := readLock(dir, lock.Name())
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, st)
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Timestamp.Before(history[j].Timestamp)
+	})
+	return history, nil
+}
+
+func printStatus(w io.Writer, dir string, asJSON bool) error {
+	history, err := restoreHistory(dir)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(history)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIMESTAMP\tMEMBER\tRESTORE ID\tSOURCE\tKEY\tCHECKSUM\tAGENT VERSION")
+	for _, st := range history {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			st.Timestamp.Format(time.RFC3339),
+			st.Member,
+			orUnknown(st.RestoreID),
+			orUnknown(st.Source),
+			orUnknown(st.Key),
+			orUnknown(st.Checksum),
+			orUnknown(st.AgentVersion),
+		)
+	}
+	return tw.Flush()
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
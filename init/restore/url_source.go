@@ -0,0 +1,148 @@
+package restore
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/verify"
+)
+
+// urlSource serves the archive at a HTTP(S) URL, e.g. a pre-signed bucket link.
+// The URL is fixed, the key only names the archive in the logs, the spool and the lock.
+type urlSource struct {
+	client *fileutil.HTTPClient
+	url    string
+	// checksumURL is the optional location of the checksum file of the archive
+	checksumURL string
+}
+
+// attributes requests the first byte of the archive rather than its headers, pre-signed links are often valid for GET requests only
+func (s urlSource) attributes(ctx context.Context, key string) (archiveAttributes, error) {
+	resp, err := s.get(ctx, key, 0, 0)
+	if err != nil {
+		return archiveAttributes{}, err
+	}
+	defer resp.Body.Close()
+
+	attrs := archiveAttributes{Size: resp.ContentLength, ETag: resp.Header.Get("ETag")}
+	if resp.StatusCode == http.StatusPartialContent {
+		attrs.Size = -1
+		if cr := resp.Header.Get("Content-Range"); strings.HasPrefix(cr, "bytes 0-0/") {
+			attrs.Size, _ = strconv.ParseInt(strings.TrimPrefix(cr, "bytes 0-0/"), 10, 64)
+		}
+	}
+	if attrs.Size < 0 {
+		return archiveAttributes{}, fmt.Errorf("the size of %s is unknown", key)
+	}
+	if md5, err := base64.StdEncoding.DecodeString(resp.Header.Get("Content-MD5")); err == nil && len(md5) > 0 {
+		attrs.MD5 = md5
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		attrs.ModTime = t.UTC()
+	}
+	if s.checksumURL != "" {
+		if attrs.SHA256, err = s.checksum(ctx, key); err != nil {
+			return archiveAttributes{}, err
+		}
+	}
+	return attrs, nil
+}
+
+// checksum reads the SHA-256 digest from the checksum file of the archive
+func (s urlSource) checksum(ctx context.Context, key string) (string, error) {
+	resp, err := s.client.Get(ctx, s.checksumURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("could not download the checksum file of %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not download the checksum file of %s: %s", key, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	if err != nil {
+		return "", err
+	}
+	digest, err := verify.ParseChecksumFile(data)
+	if err != nil {
+		return "", fmt.Errorf("invalid checksum file of %s: %w", key, err)
+	}
+	return digest, nil
+}
+
+// newRangeReader requests the archive from the offset. If the server does not support ranges, or returns
+// another range than requested, the archive is read from the start and the bytes before the offset are skipped.
+func (s urlSource) newRangeReader(ctx context.Context, key string, offset int64) (io.ReadCloser, error) {
+	resp, err := s.get(ctx, key, offset, -1)
+	if err != nil {
+		return nil, err
+	}
+	skip := offset > 0 && resp.StatusCode == http.StatusOK
+	if offset > 0 && resp.StatusCode == http.StatusPartialContent && rangeStart(resp.Header.Get("Content-Range")) != offset {
+		resp.Body.Close()
+		log.Warn("unexpected content range, downloading from the start", zap.String("key", key), zap.Int64("offset", offset),
+			zap.String("content range", resp.Header.Get("Content-Range")))
+		if resp, err = s.get(ctx, key, 0, -1); err != nil {
+			return nil, err
+		}
+		skip = true
+	}
+	if skip {
+		if _, err = io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+	return resp.Body, nil
+}
+
+// get requests the bytes from start to end inclusive, to the end of the archive if end is negative
+func (s urlSource) get(ctx context.Context, key string, start, end int64) (*http.Response, error) {
+	header := http.Header{}
+	switch {
+	case end >= 0:
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	case start > 0:
+		header.Set("Range", fmt.Sprintf("bytes=%d-", start))
+	}
+
+	// the URL of the errors is redacted, it may be pre-signed
+	resp, err := s.client.Get(ctx, s.url, header)
+	if err != nil {
+		return nil, fmt.Errorf("could not download %s: %w", key, err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("could not download %s: %s", key, resp.Status)
+	}
+	return resp, nil
+}
+
+// rangeStart returns the first byte of a Content-Range header, e.g. 42 of "bytes 42-99/100", -1 if it is invalid
+func rangeStart(contentRange string) int64 {
+	r, ok := strings.CutPrefix(contentRange, "bytes ")
+	if !ok {
+		return -1
+	}
+	start, _, ok := strings.Cut(r, "-")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// memberURL returns the archive URL of the member, replacing the {member} placeholder of the template with the member index
+func memberURL(template string, id int) string {
+	return strings.ReplaceAll(template, "{member}", strconv.Itoa(id))
+}
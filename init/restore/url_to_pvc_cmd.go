@@ -0,0 +1,152 @@
+package restore
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/kelseyhightower/envconfig"
+	"go.uber.org/zap"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/k8s"
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/uri"
+)
+
+var urlLog = logger.New().Named("restore_from_url_to_pvc")
+
+// defaultURLTimeout limits each request of the archive, an interrupted download resumes from its offset
+const defaultURLTimeout = time.Hour
+
+type URLToPVCCmd struct {
+	// URL of the archive, {member} is replaced with the member index
+	URL         string `envconfig:"RESTORE_URL" yaml:"url"`
+	Destination string `envconfig:"RESTORE_URL_DESTINATION" yaml:"destination"`
+	RestoreID   string `envconfig:"RESTORE_URL_ID" yaml:"restoreID"`
+	MaxSize     int64  `envconfig:"RESTORE_URL_MAX_SIZE" yaml:"maxSize"`
+	DryRun      bool   `envconfig:"RESTORE_URL_DRY_RUN" yaml:"dryRun"`
+	Ordinal     string `envconfig:"RESTORE_URL_ORDINAL" yaml:"ordinal"`
+	// ChecksumURL of the archive's checksum file, {member} is replaced with the member index
+	ChecksumURL string `envconfig:"RESTORE_URL_CHECKSUM_URL" yaml:"checksumURL"`
+	// Timeout limits each request of the archive
+	Timeout        time.Duration `envconfig:"RESTORE_URL_TIMEOUT" yaml:"timeout"`
+	ConnectTimeout time.Duration `envconfig:"RESTORE_URL_CONNECT_TIMEOUT" yaml:"connectTimeout"`
+}
+
+func (*URLToPVCCmd) Name() string     { return "restore_pvc_url" }
+func (*URLToPVCCmd) Synopsis() string { return "run restore pvc from URL agent" }
+func (*URLToPVCCmd) Usage() string    { return "" }
+
+func (r *URLToPVCCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&r.URL, "src", "", "src archive URL, {member} is replaced with the member index")
+	f.StringVar(&r.Destination, "dst", "/data/persistence/backup", "dst filesystem path")
+	f.StringVar(&r.RestoreID, "restore-id", "", "Restore ID for which the lock will be created.")
+	f.Int64Var(&r.MaxSize, "max-size", defaultMaxExtractSize, "maximum extracted size of the backup in bytes")
+	f.BoolVar(&r.DryRun, "dry-run", false, "log what the restore would do without changing the destination")
+	f.StringVar(&r.Ordinal, "ordinal", "", "member index, resolved from the pod-index label or the hostname if empty")
+	f.StringVar(&r.ChecksumURL, "checksum-url", "", "URL of the checksum file of the archive in sha256sum format, {member} is replaced with the member index")
+	f.DurationVar(&r.Timeout, "timeout", defaultURLTimeout, "timeout of each request of the archive, unlimited if negative")
+	f.DurationVar(&r.ConnectTimeout, "connect-timeout", fileutil.DefaultHTTPOptions.ConnectTimeout, "timeout of establishing a connection")
+}
+
+func (r *URLToPVCCmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	urlLog.Info("starting restore from URL agent...")
+
+	// overwrite config with environment variables
+	if err := envconfig.Process("restoreURL", r); err != nil {
+		urlLog.Error("an error occurred while processing config from env: " + err.Error())
+		return subcommands.ExitFailure
+	}
+	if r.URL == "" {
+		urlLog.Error("restore URL is not set")
+		return subcommands.ExitFailure
+	}
+
+	var events *k8s.EventRecorder
+	if !r.DryRun {
+		events = k8s.NewEventRecorder()
+	}
+
+	id, err := memberOrdinal(ctx, r.Ordinal, urlLog)
+	if err != nil {
+		urlLog.Error("member ordinal error: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
+	src := urlSource{client: fileutil.NewHTTPClient(r.httpOptions()), url: memberURL(r.URL, id)}
+	if r.ChecksumURL != "" {
+		src.checksumURL = memberURL(r.ChecksumURL, id)
+	}
+	// the query of pre-signed URLs is a secret, it is never logged or written to the lock
+	key := uri.Redact(src.url)
+
+	lock := filepath.Join(r.Destination, lockFileName(r.RestoreID, id))
+	if _, err = os.Stat(lock); err == nil || os.IsExist(err) {
+		// If restore lock exists exit
+		urlLog.Info("restore lock exists, exiting")
+		events.Normal(ctx, k8s.ReasonRestoreSkipped, fmt.Sprintf("Restore lock %s exists, skipping the restore", lock))
+		return subcommands.ExitSuccess
+	}
+
+	if r.DryRun {
+		plan, err := planURLToPvc(ctx, src, key, r.Destination)
+		if err != nil {
+			urlLog.Error("dry run error: " + err.Error())
+			return subcommands.ExitFailure
+		}
+		plan.log(urlLog)
+		return subcommands.ExitSuccess
+	}
+
+	urlLog.Info("Starting download:", zap.String("url", key), zap.Int("member", id))
+	checksum, err := downloadFromURLToPvc(ctx, src, key, r.Destination, r.MaxSize)
+	if err != nil {
+		urlLog.Error("download error: " + err.Error())
+		events.Warning(ctx, k8s.ReasonRestoreFailed, fmt.Sprintf("Failed to restore member %d from %s: %v", id, key, err))
+		return subcommands.ExitFailure
+	}
+
+	if err = cleanupLocks(r.Destination, id); err != nil {
+		urlLog.Error("error cleaning up locks: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
+	if err = writeLock(lock, newLockRecord(key, key, checksum)); err != nil {
+		urlLog.Error("lock file creation error: " + err.Error())
+		return subcommands.ExitFailure
+	}
+
+	urlLog.Info("restore successful")
+	events.Normal(ctx, k8s.ReasonRestoreCompleted, fmt.Sprintf("Restored member %d from %s", id, key))
+	return subcommands.ExitSuccess
+}
+
+// downloadFromURLToPvc restores the archive at the URL and returns its checksum
+func downloadFromURLToPvc(ctx context.Context, src urlSource, key, dst string, maxSize int64) (string, error) {
+	// extract next to the existing hot-restart data, which is kept until the new data is complete
+	st, err := newStage(dst)
+	if err != nil {
+		return "", err
+	}
+	defer st.cleanup()
+
+	checksum, err := saveFromArchive(ctx, src, key, filepath.Join(dst, spoolDirName), st.dir, maxSize)
+	if err != nil {
+		return "", err
+	}
+	return checksum, st.commit()
+}
+
+// httpOptions returns the options of the archive requests, the timeout of a zero value, e.g. of the compound config, is the default one
+func (r *URLToPVCCmd) httpOptions() fileutil.HTTPOptions {
+	opts := fileutil.HTTPOptions{ConnectTimeout: r.ConnectTimeout, Timeout: r.Timeout}
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultURLTimeout
+	}
+	return opts
+}
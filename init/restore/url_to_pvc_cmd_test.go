@@ -0,0 +1,191 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/uri"
+)
+
+func TestURLSource(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	modTime := time.Date(2022, 7, 29, 0, 10, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		wantETag string
+	}{
+		{
+			name: "ranges",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("ETag", `"etag"`)
+				http.ServeContent(w, r, "archive.tar.gz", modTime, bytes.NewReader(content))
+			},
+			wantETag: `"etag"`,
+		},
+		{
+			name: "unexpected range",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("ETag", `"etag"`)
+				switch r.Header.Get("Range") {
+				case "", "bytes=0-0":
+					http.ServeContent(w, r, "archive.tar.gz", modTime, bytes.NewReader(content))
+				default:
+					// the whole archive as a partial content
+					w.Header().Set("Content-Range", "bytes 0-99/100")
+					w.WriteHeader(http.StatusPartialContent)
+					_, _ = w.Write(content)
+				}
+			},
+			wantETag: `"etag"`,
+		},
+		{
+			name: "no ranges",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+				_, _ = w.Write(content)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+			src := urlSource{client: fileutil.NewHTTPClient(fileutil.HTTPOptions{}), url: srv.URL}
+
+			attrs, err := src.attributes(context.Background(), "key")
+			require.Nil(t, err)
+			require.Equal(t, archiveAttributes{Size: 100, ETag: tt.wantETag, ModTime: modTime}, attrs)
+
+			r, err := src.newRangeReader(context.Background(), "key", 42)
+			require.Nil(t, err)
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			require.Nil(t, err)
+			require.Equal(t, content[42:], got)
+		})
+	}
+
+	t.Run("error status", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		defer srv.Close()
+		src := urlSource{client: fileutil.NewHTTPClient(fileutil.HTTPOptions{}), url: srv.URL + "/archive?signature=secret"}
+
+		_, err := src.attributes(context.Background(), uri.Redact(src.url))
+		require.EqualError(t, err, "could not download "+srv.URL+"/archive: 404 Not Found")
+	})
+}
+
+func TestURLToPVCCmd(t *testing.T) {
+	// Set up
+	tmpdir := t.TempDir()
+	archiveDir := path.Join(tmpdir, "archive")
+	require.Nil(t, fileutil.CreateFiles(archiveDir, exampleTarGzFiles, true))
+	archive := path.Join(tmpdir, "member-1.tar.gz")
+	require.Nil(t, createArchiveFile(archiveDir, newUUID, archive))
+	data, err := os.ReadFile(archive)
+	require.Nil(t, err)
+
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.String())
+		if r.URL.Path != "/backups/member-1.tar.gz" || r.URL.Query().Get("signature") != "secret" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "member-1.tar.gz", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+	dst := path.Join(tmpdir, "dest")
+	require.Nil(t, fileutil.CreateFiles(dst, []fileutil.File{{Name: oldUUID, IsDir: true}}, true))
+
+	// Run test
+	t.Setenv("HOSTNAME", "hz-1")
+	cmd := &URLToPVCCmd{URL: srv.URL + "/backups/member-{member}.tar.gz?signature=secret", Destination: dst, RestoreID: "id"}
+	require.Equal(t, subcommands.ExitSuccess, cmd.Execute(context.Background(), &flag.FlagSet{}))
+	require.NotEmpty(t, requests)
+
+	uuids, err := fileutil.FolderUUIDs(dst)
+	require.Nil(t, err)
+	require.Len(t, uuids, 1)
+	require.Equal(t, newUUID, uuids[0].Name())
+	want, err := fileutil.DirFileList(archiveDir)
+	require.Nil(t, err)
+	got, err := fileutil.DirFileList(path.Join(dst, newUUID))
+	require.Nil(t, err)
+	require.ElementsMatch(t, want, got)
+
+	lock, err := os.ReadFile(path.Join(dst, lockFileName("id", 1)))
+	require.Nil(t, err)
+	require.NotContains(t, string(lock), "secret")
+	var rec lockRecord
+	require.Nil(t, json.Unmarshal(lock, &rec))
+	require.Equal(t, srv.URL+"/backups/member-1.tar.gz", rec.Key)
+	require.True(t, strings.HasPrefix(rec.Checksum, "sha256:"))
+
+	// the lock skips the next restore
+	requests = nil
+	require.Equal(t, subcommands.ExitSuccess, cmd.Execute(context.Background(), &flag.FlagSet{}))
+	require.Empty(t, requests)
+}
+
+func TestURLSource_Checksum(t *testing.T) {
+	content := []byte("archive content")
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/member-0.tar.gz":
+			http.ServeContent(w, r, "member-0.tar.gz", time.Time{}, bytes.NewReader(content))
+		case "/member-0.tar.gz.sha256":
+			_, _ = w.Write([]byte(digest + "  member-0.tar.gz\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	c := fileutil.NewHTTPClient(fileutil.HTTPOptions{})
+
+	src := urlSource{client: c, url: srv.URL + "/member-0.tar.gz", checksumURL: srv.URL + "/member-0.tar.gz.sha256"}
+	attrs, err := src.attributes(context.Background(), "key")
+	require.Nil(t, err)
+	require.Equal(t, digest, attrs.SHA256)
+
+	src.checksumURL = srv.URL + "/missing.sha256"
+	_, err = src.attributes(context.Background(), "key")
+	require.EqualError(t, err, "could not download the checksum file of key: 404 Not Found")
+}
+
+func TestRangeStart(t *testing.T) {
+	tests := []struct {
+		contentRange string
+		want         int64
+	}{
+		{"bytes 42-99/100", 42},
+		{"bytes 0-0/*", 0},
+		{"bytes */100", -1},
+		{"", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentRange, func(t *testing.T) {
+			require.Equal(t, tt.want, rangeStart(tt.contentRange))
+		})
+	}
+}
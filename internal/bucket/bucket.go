@@ -2,27 +2,39 @@ package bucket
 
 import (
 	"archive/zip"
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
-
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/aws/aws-sdk-go/aws"
+	awscredentials "github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	gcaws "gocloud.dev/aws"
 	"gocloud.dev/blob"
-	_ "gocloud.dev/blob/azureblob"
+	"gocloud.dev/blob/azureblob"
 	"gocloud.dev/blob/gcsblob"
 	"gocloud.dev/blob/s3blob"
 	"gocloud.dev/gcp"
 	"golang.org/x/oauth2/google"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	clientcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 
-	"github.com/hazelcast/platform-operator-agent/internal/k8s"
 	"github.com/hazelcast/platform-operator-agent/internal/uri"
+	"github.com/hazelcast/platform-operator-agent/internal/verify"
 )
 
 // Blob storage types
@@ -37,9 +49,21 @@ const (
 	S3AccessKeyID        = "access-key-id"
 	S3SecretAccessKey    = "secret-access-key"
 	S3Region             = "region"
-	S3EnvAccessKeyID     = "AWS_ACCESS_KEY_ID"
-	S3EnvSecretAccessKey = "AWS_SECRET_ACCESS_KEY"
-	S3EnvRegion          = "AWS_REGION"
+	S3Endpoint           = "endpoint"
+	S3ForcePathStyle     = "force-path-style"
+	S3CABundle           = "ca-bundle"
+	S3InsecureSkipVerify = "insecure-skip-verify"
+	S3RoleARN            = "role-arn"
+	S3ExternalID         = "external-id"
+	S3RoleSessionName    = "role-session-name"
+	S3WebIdentityToken   = "web-identity-token-file"
+	S3STSEndpoint        = "sts-endpoint"
+)
+
+const (
+	defaultRoleSessionName = "hazelcast-platform-operator-agent"
+	// temporary credentials are refreshed this long before they expire, so long uploads never use expired ones
+	roleCredentialsExpiryWindow = 5 * time.Minute
 )
 
 // GCP
@@ -49,27 +73,36 @@ const (
 
 // Azure
 const (
-	AzureStorageAccount    = "storage-account"
-	AzureStorageKey        = "storage-key"
-	AzureEnvStorageAccount = "AZURE_STORAGE_ACCOUNT"
-	AzureEnvStorageKey     = "AZURE_STORAGE_KEY"
+	AzureStorageAccount = "storage-account"
+	AzureStorageKey     = "storage-key"
+	AzureSASToken       = "sas-token"
+	AzureClientID       = "client-id"
+	AzureClientSecret   = "client-secret"
+	AzureTenantID       = "tenant-id"
+	AzureAuthorityHost  = "authority-host"
 )
 
+// service principal tokens are refreshed this long before they expire
+const azureTokenRefreshTolerance = 5 * time.Minute
+
+// OpenBucket opens the bucket using the credentials from the given secret. Every call builds its
+// own provider session and client, so concurrent calls with different secrets never share credentials.
 func OpenBucket(ctx context.Context, bucketURL string, secretName string) (*blob.Bucket, error) {
 	var secretData map[string][]byte
 
 	// if secretName is not empty, then read the bucket authentication secret from the given secret.
 	if secretName != "" {
-		sr, err := newSecretReader()
-		if err != nil {
-			return nil, err
-		}
-		secretData, err = sr.secretData(ctx, secretName)
+		var err error
+		secretData, err = SecretData(ctx, secretName)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	return openBucket(ctx, bucketURL, secretData)
+}
+
+func openBucket(ctx context.Context, bucketURL string, secretData map[string][]byte) (*blob.Bucket, error) {
 	switch {
 	case strings.HasPrefix(bucketURL, AWS):
 		return openAWS(ctx, bucketURL, secretData)
@@ -85,72 +118,172 @@ func OpenBucket(ctx context.Context, bucketURL string, secretName string) (*blob
 	}
 }
 
-type secretReader struct {
-	clientcorev1.SecretInterface
-}
+func openAWS(ctx context.Context, bucketURL string, secret map[string][]byte) (*blob.Bucket, error) {
+	if secret == nil {
+		return openAWSWithSession(ctx, bucketURL)
+	}
 
-func newSecretReader() (*secretReader, error) {
-	c, err := k8s.Client()
+	s, err := awsSession(secret)
 	if err != nil {
 		return nil, err
 	}
 
-	ns, err := k8s.Namespace()
+	return openS3Bucket(ctx, s, bucketURL)
+}
+
+func openAWSWithSession(ctx context.Context, bucketURL string) (*blob.Bucket, error) {
+	s, err := session.NewSession(&aws.Config{HTTPClient: awsHTTPClient(false)})
 	if err != nil {
 		return nil, err
 	}
 
-	return &secretReader{SecretInterface: c.CoreV1().Secrets(ns)}, nil
+	return openS3Bucket(ctx, s, bucketURL)
 }
 
-func (sr secretReader) secretData(ctx context.Context, sn string) (map[string][]byte, error) {
-	secret, err := sr.Get(ctx, sn, metav1.GetOptions{})
+func openS3Bucket(ctx context.Context, s *session.Session, bucketURL string) (*blob.Bucket, error) {
+	u, err := url.Parse(bucketURL)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(secret.Data) == 0 {
-		return nil, fmt.Errorf("the data in the bucket authentication secret is empty: %s", secret.Name)
+	// region, endpoint, disableSSL and s3ForcePathStyle in the bucket URL take precedence over the secret,
+	// as they do for the default URL opener
+	q := u.Query()
+	prefix := q.Get("prefix")
+	q.Del("prefix")
+	cfg, err := gcaws.ConfigFromURLParams(q)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bucket URL: %w", err)
+	}
+
+	bucket, err := s3blob.OpenBucket(ctx, s.Copy(cfg), u.Host, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	return secret.Data, nil
+	return blob.PrefixedBucket(bucket, prefix), nil
 }
 
-func openAWS(ctx context.Context, bucketURL string, secret map[string][]byte) (*blob.Bucket, error) {
-	if secret == nil {
-		return openAWSWithSession(ctx, bucketURL)
+// awsSession builds the S3 session from the bucket secret. Besides the static credentials,
+// the secret may point to an S3-compatible endpoint such as MinIO or Ceph RGW, or to a role
+// to assume for temporary credentials.
+func awsSession(secret map[string][]byte) (*session.Session, error) {
+	_, hasRole := secret[S3RoleARN]
+	_, hasKeyID := secret[S3AccessKeyID]
+	_, hasAccessKey := secret[S3SecretAccessKey]
+	// static keys are only optional if a role is assumed, they are then the source credentials
+	staticKeys := !hasRole || hasKeyID || hasAccessKey
+
+	if _, ok := secret[S3WebIdentityToken]; ok && !hasRole {
+		return nil, fmt.Errorf("invalid secret: missing key: %v", S3RoleARN)
 	}
 
-	if err := setCredentialEnv(secret, S3AccessKeyID, S3EnvAccessKeyID); err != nil {
-		return nil, err
+	var keyID, accessKey string
+	var err error
+	if staticKeys {
+		keyID, err = secretValue(secret, S3AccessKeyID)
+		if err != nil {
+			return nil, err
+		}
 	}
-	if err := setCredentialEnv(secret, S3Region, S3EnvRegion); err != nil {
+	region, err := secretValue(secret, S3Region)
+	if err != nil {
 		return nil, err
 	}
-	if err := setCredentialEnv(secret, S3SecretAccessKey, S3EnvSecretAccessKey); err != nil {
-		return nil, err
+	if staticKeys {
+		accessKey, err = secretValue(secret, S3SecretAccessKey)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return blob.OpenBucket(ctx, bucketURL)
-}
-
-func openAWSWithSession(ctx context.Context, bucketURL string) (*blob.Bucket, error) {
-	s, err := session.NewSession()
+	insecure, err := secretBool(secret, S3InsecureSkipVerify)
 	if err != nil {
 		return nil, err
 	}
 
-	u, err := url.Parse(bucketURL)
+	opts := session.Options{
+		Config: aws.Config{
+			Region:     aws.String(region),
+			HTTPClient: awsHTTPClient(insecure),
+		},
+	}
+	if staticKeys {
+		opts.Config.Credentials = awscredentials.NewStaticCredentials(keyID, accessKey, "")
+	}
+
+	if ca, ok := secret[S3CABundle]; ok {
+		if ok := x509.NewCertPool().AppendCertsFromPEM(ca); !ok {
+			return nil, fmt.Errorf("invalid secret: no PEM certificates found in key: %v", S3CABundle)
+		}
+		// the SDK loads the bundle into the client transport, it takes precedence over AWS_CA_BUNDLE
+		opts.CustomCABundle = bytes.NewReader(ca)
+	}
+
+	s, err := session.NewSessionWithOptions(opts)
 	if err != nil {
 		return nil, err
 	}
 
-	bucket, err := s3blob.OpenBucket(ctx, s, u.Host, nil)
+	if hasRole {
+		// the source session calls STS, the S3 endpoint is only set on the final session
+		stsSession := s
+		if endpoint, ok := secret[S3STSEndpoint]; ok {
+			stsSession = s.Copy(&aws.Config{Endpoint: aws.String(string(endpoint))})
+		}
+		s = s.Copy(&aws.Config{Credentials: roleCredentials(stsSession, secret)})
+	}
+
+	s3Config := &aws.Config{}
+	if endpoint, ok := secret[S3Endpoint]; ok {
+		s3Config.Endpoint = aws.String(string(endpoint))
+	}
+
+	forcePathStyle, err := secretBool(secret, S3ForcePathStyle)
 	if err != nil {
 		return nil, err
 	}
+	if forcePathStyle {
+		s3Config.S3ForcePathStyle = aws.Bool(true)
+	}
 
-	return blob.PrefixedBucket(bucket, u.Query().Get("prefix")), nil
+	return s.Copy(s3Config), nil
+}
+
+// roleCredentials returns the temporary credentials of the role from the secret. They are refreshed
+// automatically before they expire.
+func roleCredentials(stsSession *session.Session, secret map[string][]byte) *awscredentials.Credentials {
+	roleARN := string(secret[S3RoleARN])
+	sessionName := defaultRoleSessionName
+	if name, ok := secret[S3RoleSessionName]; ok {
+		sessionName = string(name)
+	}
+
+	if tokenFile, ok := secret[S3WebIdentityToken]; ok {
+		p := stscreds.NewWebIdentityRoleProvider(sts.New(stsSession), roleARN, sessionName, string(tokenFile))
+		p.ExpiryWindow = roleCredentialsExpiryWindow
+		return awscredentials.NewCredentials(p)
+	}
+
+	return stscreds.NewCredentials(stsSession, roleARN, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = sessionName
+		p.ExpiryWindow = roleCredentialsExpiryWindow
+		if externalID, ok := secret[S3ExternalID]; ok {
+			p.ExternalID = aws.String(string(externalID))
+		}
+	})
+}
+
+// awsHTTPClient returns a new client for every session, otherwise the SDK installs
+// CA bundles on the shared http.DefaultClient.
+func awsHTTPClient(insecure bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// only for S3-compatible endpoints with self-signed certificates, must be enabled explicitly
+		InsecureSkipVerify: insecure,
+	}
+	return &http.Client{Transport: transport}
 }
 
 func openGCP(ctx context.Context, bucketURL string, secret map[string][]byte) (*blob.Bucket, error) {
@@ -196,25 +329,161 @@ func credentials(ctx context.Context, secret map[string][]byte) (*google.Credent
 }
 
 func openAZURE(ctx context.Context, bucketURL string, secret map[string][]byte) (*blob.Bucket, error) {
-	if secret != nil {
-		if err := setCredentialEnv(secret, AzureStorageAccount, AzureEnvStorageAccount); err != nil {
-			return nil, err
+	if secret == nil {
+		return blob.OpenBucket(ctx, bucketURL)
+	}
+
+	accountName, err := secretValue(secret, AzureStorageAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, opts, err := azureCredential(ctx, accountName, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(bucketURL)
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	prefix := q.Get("prefix")
+	q.Del("prefix")
+	if err = azureOptionsFromURLParams(q, opts); err != nil {
+		return nil, fmt.Errorf("invalid bucket URL: %w", err)
+	}
+
+	pipeline := azureblob.NewPipeline(credential, azblob.PipelineOptions{})
+	bucket, err := azureblob.OpenBucket(ctx, pipeline, azureblob.AccountName(accountName), u.Host, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return blob.PrefixedBucket(bucket, prefix), nil
+}
+
+// azureOptionsFromURLParams applies the domain, protocol and cdn parameters of the bucket URL,
+// as the default URL opener does, e.g. for sovereign clouds or Azurite
+func azureOptionsFromURLParams(q url.Values, opts *azureblob.Options) error {
+	for param, values := range q {
+		if len(values) > 1 {
+			return fmt.Errorf("multiple values of %q not allowed", param)
 		}
+		value := values[0]
+		switch param {
+		case "domain":
+			opts.StorageDomain = azureblob.StorageDomain(value)
+		case "protocol":
+			opts.Protocol = azureblob.Protocol(value)
+		case "cdn":
+			isCDN, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for query parameter %q: %w", param, err)
+			}
+			opts.IsCDN = isCDN
+		default:
+			return fmt.Errorf("unknown query parameter %q", param)
+		}
+	}
+	return nil
+}
 
-		if err := setCredentialEnv(secret, AzureStorageKey, AzureEnvStorageKey); err != nil {
-			return nil, err
+// azureCredential picks the credential type from the keys of the secret: a SAS token, a service
+// principal or the storage account key.
+func azureCredential(ctx context.Context, accountName string, secret map[string][]byte) (azblob.Credential, *azureblob.Options, error) {
+	if sasToken, ok := secret[AzureSASToken]; ok {
+		return azblob.NewAnonymousCredential(), &azureblob.Options{SASToken: azureblob.SASToken(sasToken)}, nil
+	}
+
+	if _, ok := secret[AzureClientID]; ok {
+		credential, err := azureServicePrincipalCredential(ctx, secret)
+		if err != nil {
+			return nil, nil, err
 		}
+		return credential, &azureblob.Options{}, nil
 	}
 
-	return blob.OpenBucket(ctx, bucketURL)
+	accountKey, err := secretValue(secret, AzureStorageKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	credential, err := azureblob.NewCredential(azureblob.AccountName(accountName), azureblob.AccountKey(accountKey))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid secret: invalid Azure storage credentials: %w", err)
+	}
+
+	// the shared key credential is required for SignedURL
+	return credential, &azureblob.Options{Credential: credential}, nil
+}
+
+func azureServicePrincipalCredential(ctx context.Context, secret map[string][]byte) (azblob.TokenCredential, error) {
+	clientID, err := secretValue(secret, AzureClientID)
+	if err != nil {
+		return nil, err
+	}
+	clientSecret, err := secretValue(secret, AzureClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	tenantID, err := secretValue(secret, AzureTenantID)
+	if err != nil {
+		return nil, err
+	}
+	authorityHost := azure.PublicCloud.ActiveDirectoryEndpoint
+	if host, ok := secret[AzureAuthorityHost]; ok {
+		authorityHost = string(host)
+	}
+
+	oauthConfig, err := adal.NewOAuthConfig(authorityHost, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	spt, err := adal.NewServicePrincipalToken(*oauthConfig, clientID, clientSecret, azure.PublicCloud.ResourceIdentifiers.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// acquire the first token now, so invalid credentials fail when the bucket is opened
+	if err = spt.RefreshWithContext(ctx); err != nil {
+		return nil, fmt.Errorf("failed to acquire token for Azure service principal: %w", err)
+	}
+
+	return azblob.NewTokenCredential(spt.Token().AccessToken, func(credential azblob.TokenCredential) time.Duration {
+		if err := spt.EnsureFresh(); err != nil {
+			// stops the refresh, the requests will fail with the expired token
+			return 0
+		}
+		token := spt.Token()
+		credential.SetToken(token.AccessToken)
+		if d := time.Until(token.Expires()) - azureTokenRefreshTolerance; d > 0 {
+			return d
+		}
+		return time.Minute
+	}), nil
+}
+
+func secretValue(secret map[string][]byte, key string) (string, error) {
+	value, ok := secret[key]
+	if !ok {
+		return "", fmt.Errorf("invalid secret: missing key: %v", key)
+	}
+	return string(value), nil
 }
 
-func setCredentialEnv(secret map[string][]byte, key, name string) error {
+// secretBool parses an optional boolean key of the secret, absent keys are false.
+func secretBool(secret map[string][]byte, key string) (bool, error) {
 	value, ok := secret[key]
 	if !ok {
-		return fmt.Errorf("invalid secret: missing key: %v", key)
+		return false, nil
 	}
-	return os.Setenv(name, string(value))
+	b, err := strconv.ParseBool(strings.TrimSpace(string(value)))
+	if err != nil {
+		return false, fmt.Errorf("invalid secret: invalid boolean value for key: %v", key)
+	}
+	return b, nil
 }
 
 func DownloadFile(ctx context.Context, src, dst, filename string, secretName string) error {
@@ -232,35 +501,40 @@ func DownloadFile(ctx context.Context, src, dst, filename string, secretName str
 		return fmt.Errorf("not found: jar with the name not found: %v", filename)
 	}
 
-	if err = saveFile(ctx, b, filename, dst); err != nil {
+	if err = saveFile(ctx, b, filename, dst, nil); err != nil {
 		return err
 	}
 
 	return b.Close()
 }
 
-func DownloadFiles(ctx context.Context, src, dst string, secretName string) error {
+// DownloadFiles downloads the objects of the bucket selected by the options into dst, which must exist
+func DownloadFiles(ctx context.Context, src, dst string, secretName string, opts DownloadOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
 	b, err := OpenBucket(ctx, src, secretName)
 	if err != nil {
 		return err
 	}
 	defer b.Close()
 
-	iter := b.List(nil)
-	for {
-		obj, err := iter.Next(ctx)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
+	v, err := verify.New(ctx, opts.Verify, fetch(b))
+	if err != nil {
+		return err
+	}
+
+	objs, err := selectObjects(ctx, b, opts, v)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		if err = mkdirs(dst, path.Dir(obj.Key)); err != nil {
 			return err
 		}
-		// we only want top level files and no files under sub-folders
-		if path.Base(obj.Key) != obj.Key {
-			continue
-		}
-
-		if err = saveFile(ctx, b, obj.Key, dst); err != nil {
+		if err = saveFile(ctx, b, obj.Key, dst, v); err != nil {
 			return err
 		}
 	}
@@ -268,6 +542,21 @@ func DownloadFiles(ctx context.Context, src, dst string, secretName string) erro
 	return b.Close()
 }
 
+// mkdirs creates the relative directory below dst, which must exist
+func mkdirs(dst, rel string) error {
+	if rel == "." {
+		return nil
+	}
+	if err := mkdirs(dst, path.Dir(rel)); err != nil {
+		return err
+	}
+	err := os.Mkdir(filepath.Join(dst, rel), 0755)
+	if os.IsExist(err) {
+		return nil
+	}
+	return err
+}
+
 type BundleReq struct {
 	URL        string `json:"url"`
 	SecretName string `json:"secret_name"`
@@ -330,31 +619,26 @@ func addToZip(ctx context.Context, b *blob.Bucket, obj *blob.ListObject, w *zip.
 	return nil
 }
 
-func saveFile(ctx context.Context, bucket *blob.Bucket, key, path string) error {
+// saveFile downloads the object into the path, it is placed only if the verifier accepts it
+func saveFile(ctx context.Context, bucket *blob.Bucket, key, path string, v *verify.Verifier) error {
 	s, err := bucket.NewReader(ctx, key, nil)
 	if err != nil {
 		return err
 	}
 	defer s.Close()
 
-	destPath := filepath.Join(path, key)
-
-	d, err := os.Create(destPath)
-	if err != nil {
+	if err = verify.SaveFile(ctx, v, key, key, s, filepath.Join(path, key)); err != nil {
 		return err
 	}
-	defer d.Close()
 
-	if _, err = io.Copy(d, s); err != nil {
-		return err
-	}
+	return s.Close()
+}
 
-	// flush file
-	if err = d.Sync(); err != nil {
-		return err
+// fetch reads the objects with the companion files of the verifier
+func fetch(bucket *blob.Bucket) verify.Fetch {
+	return func(ctx context.Context, key, suffix string) ([]byte, error) {
+		return bucket.ReadAll(ctx, key+suffix)
 	}
-
-	return s.Close()
 }
 
 func RemoveFile(ctx context.Context, bucket, key string, secretName string) error {
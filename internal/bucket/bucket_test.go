@@ -2,12 +2,24 @@ package bucket
 
 import (
 	"context"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path"
+	"regexp"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/azureblob"
 	_ "gocloud.dev/blob/fileblob"
 	"gocloud.dev/blob/memblob"
 	corev1 "k8s.io/api/core/v1"
@@ -49,7 +61,7 @@ func TestSaveFileFromBackup(t *testing.T) {
 			}
 
 			// Run the tests
-			err = saveFile(context.Background(), b, tt.key, dstPath)
+			err = saveFile(context.Background(), b, tt.key, dstPath, nil)
 			require.Equal(t, tt.errWanted, err != nil, "Error is: ", err)
 			if err != nil {
 				require.Contains(t, err.Error(), "no such file or directory")
@@ -143,7 +155,7 @@ func TestDownloadFiles(t *testing.T) {
 			}
 
 			// Run the tests
-			err = DownloadFiles(context.Background(), "file://"+bucketPath, dstPath, "")
+			err = DownloadFiles(context.Background(), "file://"+bucketPath, dstPath, "", DownloadOptions{})
 			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
 			if err != nil {
 				require.Contains(t, err.Error(), "no such file or directory")
@@ -200,7 +212,7 @@ func TestSecretReader_SecretData(t *testing.T) {
 			if test.secretName != "" && test.data != nil {
 				sr = fakeSecretReader(test.secretName, test.data)
 			}
-			data, err := sr.secretData(context.Background(), test.secretName)
+			data, err := sr.SecretData(context.Background(), test.secretName)
 			require.Nil(t, err)
 			require.Equal(t, test.data, data)
 		})
@@ -235,7 +247,7 @@ func TestSecretReader_SecretData_Error(t *testing.T) {
 			if test.secretName != "" && test.data != nil {
 				sr = fakeSecretReader(test.secretName, test.data)
 			}
-			data, err := sr.secretData(context.Background(), test.secretName)
+			data, err := sr.SecretData(context.Background(), test.secretName)
 			require.EqualError(t, err, test.errMsg)
 			require.Nil(t, data)
 		})
@@ -376,3 +388,550 @@ func TestOpenAzure_MissingSecretKey(t *testing.T) {
 		})
 	}
 }
+
+// fakeS3 is a minimal path-style S3 stand-in storing objects in memory.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	// access key IDs used to write the objects
+	writers map[string]string
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string][]byte{}, writers: map[string]string{}}
+}
+
+var credentialRE = regexp.MustCompile(`Credential=([^/]+)/`)
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.objects[r.URL.Path] = data
+		if m := credentialRE.FindStringSubmatch(r.Header.Get("Authorization")); m != nil {
+			f.writers[r.URL.Path] = m[1]
+		}
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodGet, http.MethodHead:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", `"etag"`)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(data)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestOpenAWS_CustomEndpoint(t *testing.T) {
+	fake := newFakeS3()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	ctx := context.Background()
+	secret := map[string][]byte{
+		S3AccessKeyID:     []byte("access-key-id"),
+		S3SecretAccessKey: []byte("secret-access-key"),
+		S3Region:          []byte("us-east-1"),
+		S3Endpoint:        []byte(srv.URL),
+		S3ForcePathStyle:  []byte("true"),
+	}
+	b, err := openAWS(ctx, "s3://sample?prefix=hazelcast/", secret)
+	require.NoError(t, err)
+	defer b.Close()
+
+	require.NoError(t, b.WriteAll(ctx, "backup.tar.gz", []byte("content"), nil))
+	require.Contains(t, fake.objects, "/sample/hazelcast/backup.tar.gz")
+
+	got, err := b.ReadAll(ctx, "backup.tar.gz")
+	require.NoError(t, err)
+	require.Equal(t, []byte("content"), got)
+}
+
+func TestOpenAWS_URLEndpoint(t *testing.T) {
+	fake := newFakeS3()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	other := newFakeS3()
+	otherSrv := httptest.NewServer(other)
+	defer otherSrv.Close()
+
+	ctx := context.Background()
+	secret := map[string][]byte{
+		S3AccessKeyID:     []byte("access-key-id"),
+		S3SecretAccessKey: []byte("secret-access-key"),
+		S3Region:          []byte("us-east-1"),
+		S3Endpoint:        []byte(otherSrv.URL),
+	}
+	// the endpoint of the URL takes precedence over the one of the secret
+	b, err := openAWS(ctx, "s3://sample?endpoint="+url.QueryEscape(srv.URL)+"&s3ForcePathStyle=true&disableSSL=true&prefix=hazelcast/", secret)
+	require.NoError(t, err)
+	defer b.Close()
+
+	require.NoError(t, b.WriteAll(ctx, "backup.tar.gz", []byte("content"), nil))
+	require.Contains(t, fake.objects, "/sample/hazelcast/backup.tar.gz")
+	require.Empty(t, other.objects)
+
+	_, err = openAWS(ctx, "s3://sample?endpont="+url.QueryEscape(srv.URL), secret)
+	require.EqualError(t, err, `invalid bucket URL: unknown query parameter "endpont"`)
+}
+
+func TestOpenAWS_CABundle(t *testing.T) {
+	fake := newFakeS3()
+	srv := httptest.NewUnstartedServer(fake)
+	// handshake failures are expected for the unknown CA
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	tests := []struct {
+		name    string
+		extra   map[string][]byte
+		wantErr bool
+	}{
+		{"unknown CA", map[string][]byte{}, true},
+		{"custom CA bundle", map[string][]byte{S3CABundle: ca}, false},
+		{"TLS verification disabled", map[string][]byte{S3InsecureSkipVerify: []byte("true")}, false},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := map[string][]byte{
+				S3AccessKeyID:     []byte("access-key-id"),
+				S3SecretAccessKey: []byte("secret-access-key"),
+				S3Region:          []byte("us-east-1"),
+				S3Endpoint:        []byte(srv.URL),
+				S3ForcePathStyle:  []byte("true"),
+			}
+			for k, v := range tt.extra {
+				secret[k] = v
+			}
+			b, err := openAWS(ctx, "s3://sample", secret)
+			require.NoError(t, err)
+			defer b.Close()
+
+			err = b.WriteAll(ctx, "file.jar", []byte("content"), nil)
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+		})
+	}
+}
+
+func TestOpenAWS_InvalidEndpointOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		extra  map[string][]byte
+		errMsg string
+	}{
+		{
+			"invalid path style flag",
+			map[string][]byte{S3ForcePathStyle: []byte("maybe")},
+			fmt.Sprintf("invalid secret: invalid boolean value for key: %v", S3ForcePathStyle),
+		},
+		{
+			"invalid CA bundle",
+			map[string][]byte{S3CABundle: []byte("not a certificate")},
+			fmt.Sprintf("invalid secret: no PEM certificates found in key: %v", S3CABundle),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := map[string][]byte{
+				S3AccessKeyID:     []byte("access-key-id"),
+				S3SecretAccessKey: []byte("secret-access-key"),
+				S3Region:          []byte("us-east-1"),
+			}
+			for k, v := range tt.extra {
+				secret[k] = v
+			}
+			_, err := openAWS(context.Background(), "s3://sample", secret)
+			require.EqualError(t, err, tt.errMsg)
+		})
+	}
+}
+
+func TestOpenBucket_ParallelAWSCredentials(t *testing.T) {
+	fake := newFakeS3()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	ctx := context.Background()
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			secret := map[string][]byte{
+				S3AccessKeyID:     []byte(fmt.Sprintf("access-key-id-%d", i)),
+				S3SecretAccessKey: []byte(fmt.Sprintf("secret-access-key-%d", i)),
+				S3Region:          []byte("us-east-1"),
+				S3Endpoint:        []byte(srv.URL),
+				S3ForcePathStyle:  []byte("true"),
+			}
+			b, err := openBucket(ctx, "s3://sample", secret)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer b.Close()
+			errs <- b.WriteAll(ctx, fmt.Sprintf("object-%d", i), []byte("content"), nil)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < n; i++ {
+		require.Equal(t, fmt.Sprintf("access-key-id-%d", i), fake.writers[fmt.Sprintf("/sample/object-%d", i)])
+	}
+}
+
+func TestOpenBucket_ParallelAzureCredentials(t *testing.T) {
+	ctx := context.Background()
+	const n = 10
+	var wg sync.WaitGroup
+	hosts := make([]string, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			secret := map[string][]byte{
+				AzureStorageAccount: []byte(fmt.Sprintf("account%d", i)),
+				AzureStorageKey:     []byte("c3RvcmFnZS1rZXkK"),
+			}
+			b, err := openBucket(ctx, "azblob://sample", secret)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer b.Close()
+			var container *azblob.ContainerURL
+			if !b.As(&container) {
+				errs[i] = fmt.Errorf("not an Azure bucket")
+				return
+			}
+			u := container.URL()
+			hosts[i] = u.Host
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		require.NoError(t, errs[i])
+		require.Equal(t, fmt.Sprintf("account%d.blob.core.windows.net", i), hosts[i])
+	}
+}
+
+// fakeSTS issues a new temporary access key for every request, the credentials expire within
+// the refresh window, so every S3 request fetches new ones.
+type fakeSTS struct {
+	mu       sync.Mutex
+	requests []url.Values
+}
+
+func (f *fakeSTS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, r.PostForm)
+	n := len(f.requests)
+	f.mu.Unlock()
+
+	action := r.PostForm.Get("Action")
+	expiration := time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+	w.Header().Set("Content-Type", "text/xml")
+	_, _ = fmt.Fprintf(w, `<%[1]sResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <%[1]sResult>
+    <Credentials>
+      <AccessKeyId>temporary-key-%[2]d</AccessKeyId>
+      <SecretAccessKey>temporary-secret</SecretAccessKey>
+      <SessionToken>session-token</SessionToken>
+      <Expiration>%[3]s</Expiration>
+    </Credentials>
+  </%[1]sResult>
+  <ResponseMetadata><RequestId>%[2]d</RequestId></ResponseMetadata>
+</%[1]sResponse>`, action, n, expiration)
+}
+
+func TestOpenAWS_AssumeRole(t *testing.T) {
+	s3 := newFakeS3()
+	s3Srv := httptest.NewServer(s3)
+	defer s3Srv.Close()
+	tokenFile := path.Join(t.TempDir(), "token")
+	require.Nil(t, os.WriteFile(tokenFile, []byte("web-identity-token"), 0600))
+
+	tests := []struct {
+		name        string
+		secret      map[string][]byte
+		wantRequest url.Values
+	}{
+		{
+			"assume role with static source credentials",
+			map[string][]byte{
+				S3AccessKeyID:     []byte("access-key-id"),
+				S3SecretAccessKey: []byte("secret-access-key"),
+				S3RoleARN:         []byte("arn:aws:iam::123456789012:role/backup"),
+				S3ExternalID:      []byte("external-id"),
+				S3RoleSessionName: []byte("hazelcast-0"),
+			},
+			url.Values{
+				"Action":          {"AssumeRole"},
+				"RoleArn":         {"arn:aws:iam::123456789012:role/backup"},
+				"ExternalId":      {"external-id"},
+				"RoleSessionName": {"hazelcast-0"},
+			},
+		},
+		{
+			"web identity",
+			map[string][]byte{
+				S3RoleARN:          []byte("arn:aws:iam::123456789012:role/backup"),
+				S3WebIdentityToken: []byte(tokenFile),
+			},
+			url.Values{
+				"Action":           {"AssumeRoleWithWebIdentity"},
+				"RoleArn":          {"arn:aws:iam::123456789012:role/backup"},
+				"RoleSessionName":  {defaultRoleSessionName},
+				"WebIdentityToken": {"web-identity-token"},
+			},
+		},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sts := &fakeSTS{}
+			stsSrv := httptest.NewServer(sts)
+			defer stsSrv.Close()
+
+			tt.secret[S3Region] = []byte("us-east-1")
+			tt.secret[S3Endpoint] = []byte(s3Srv.URL)
+			tt.secret[S3STSEndpoint] = []byte(stsSrv.URL)
+			tt.secret[S3ForcePathStyle] = []byte("true")
+			b, err := openAWS(ctx, "s3://sample", tt.secret)
+			require.NoError(t, err)
+			defer b.Close()
+
+			// credentials are refreshed between the uploads
+			require.NoError(t, b.WriteAll(ctx, "first", []byte("content"), nil))
+			require.NoError(t, b.WriteAll(ctx, "second", []byte("content"), nil))
+			require.Equal(t, "temporary-key-1", s3.writers["/sample/first"])
+			require.Equal(t, "temporary-key-2", s3.writers["/sample/second"])
+
+			require.Len(t, sts.requests, 2)
+			for k, v := range tt.wantRequest {
+				require.Equal(t, v, sts.requests[0][k], k)
+			}
+		})
+	}
+}
+
+func TestOpenAWS_AssumeRole_MissingSecretKey(t *testing.T) {
+	tests := []struct {
+		secret     map[string][]byte
+		missingKey string
+	}{
+		{
+			secret: map[string][]byte{
+				S3RoleARN: []byte("arn:aws:iam::123456789012:role/backup"),
+			},
+			missingKey: S3Region,
+		},
+		{
+			secret: map[string][]byte{
+				S3RoleARN:     []byte("arn:aws:iam::123456789012:role/backup"),
+				S3Region:      []byte("us-east-1"),
+				S3AccessKeyID: []byte("access-key-id"),
+			},
+			missingKey: S3SecretAccessKey,
+		},
+		{
+			secret: map[string][]byte{
+				S3WebIdentityToken: []byte("/var/run/secrets/token"),
+				S3Region:           []byte("us-east-1"),
+			},
+			missingKey: S3RoleARN,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("without %s", test.missingKey), func(t *testing.T) {
+			_, err := openAWS(context.Background(), "s3://sample", test.secret)
+			require.EqualError(t, err, fmt.Sprintf("invalid secret: missing key: %v", test.missingKey))
+		})
+	}
+}
+
+func TestOpenAzure_SASToken(t *testing.T) {
+	ctx := context.Background()
+	secret := map[string][]byte{
+		AzureStorageAccount: []byte("account"),
+		AzureSASToken:       []byte("?sv=2020-08-04&sr=c&sp=rwdl&sig=signature"),
+	}
+	b, err := openAZURE(ctx, "azblob://sample", secret)
+	require.NoError(t, err)
+	defer b.Close()
+
+	var container *azblob.ContainerURL
+	require.True(t, b.As(&container))
+	u := container.URL()
+	require.Equal(t, "account.blob.core.windows.net", u.Host)
+	require.Equal(t, "sv=2020-08-04&sr=c&sp=rwdl&sig=signature", u.RawQuery)
+}
+
+func TestOpenAzure_URLParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		wantHost string
+		wantErr  string
+	}{
+		{
+			name:     "sovereign cloud",
+			url:      "azblob://sample?domain=blob.core.chinacloudapi.cn",
+			wantHost: "https://account.blob.core.chinacloudapi.cn",
+		},
+		{
+			name:     "azurite",
+			url:      "azblob://sample?domain=localhost:10000&protocol=http&prefix=hazelcast/",
+			wantHost: "http://localhost:10000",
+		},
+		{
+			name:    "invalid cdn flag",
+			url:     "azblob://sample?cdn=maybe",
+			wantErr: `invalid bucket URL: invalid value for query parameter "cdn": strconv.ParseBool: parsing "maybe": invalid syntax`,
+		},
+		{
+			name:    "unknown param",
+			url:     "azblob://sample?region=eu",
+			wantErr: `invalid bucket URL: unknown query parameter "region"`,
+		},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := map[string][]byte{
+				AzureStorageAccount: []byte("account"),
+				AzureSASToken:       []byte("sv=2020-08-04&sig=signature"),
+			}
+			b, err := openAZURE(ctx, tt.url, secret)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			defer b.Close()
+
+			var container *azblob.ContainerURL
+			require.True(t, b.As(&container))
+			u := container.URL()
+			require.Equal(t, tt.wantHost, u.Scheme+"://"+u.Host)
+		})
+	}
+}
+
+func TestOpenAzure_ServicePrincipal(t *testing.T) {
+	var form url.Values
+	aad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tenant-id/oauth2/token" || r.ParseForm() != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		form = r.PostForm
+		expiresOn := time.Now().Add(time.Hour).Unix()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token":"access-token","expires_in":"3600","expires_on":"%d","not_before":"%d","resource":"%s","token_type":"Bearer"}`,
+			expiresOn, expiresOn-3600, form.Get("resource"))
+	}))
+	defer aad.Close()
+
+	ctx := context.Background()
+	secret := map[string][]byte{
+		AzureStorageAccount: []byte("account"),
+		AzureClientID:       []byte("client-id"),
+		AzureClientSecret:   []byte("client-secret"),
+		AzureTenantID:       []byte("tenant-id"),
+		AzureAuthorityHost:  []byte(aad.URL),
+	}
+	credential, opts, err := azureCredential(ctx, "account", secret)
+	require.NoError(t, err)
+	require.Equal(t, &azureblob.Options{}, opts)
+
+	token, ok := credential.(azblob.TokenCredential)
+	require.True(t, ok)
+	require.Equal(t, "access-token", token.Token())
+	require.Equal(t, "client_credentials", form.Get("grant_type"))
+	require.Equal(t, "client-id", form.Get("client_id"))
+	require.Equal(t, "client-secret", form.Get("client_secret"))
+	require.Equal(t, "https://storage.azure.com/", form.Get("resource"))
+
+	secret[AzureClientSecret] = []byte("wrong-secret")
+	aad.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	_, err = openAZURE(ctx, "azblob://sample", secret)
+	require.ErrorContains(t, err, "failed to acquire token for Azure service principal")
+}
+
+func TestOpenAzure_ServicePrincipal_MissingSecretKey(t *testing.T) {
+	tests := []struct {
+		secret     map[string][]byte
+		missingKey string
+	}{
+		{
+			secret: map[string][]byte{
+				AzureClientID:     []byte("client-id"),
+				AzureClientSecret: []byte("client-secret"),
+				AzureTenantID:     []byte("tenant-id"),
+			},
+			missingKey: AzureStorageAccount,
+		},
+		{
+			secret: map[string][]byte{
+				AzureStorageAccount: []byte("storage-account"),
+				AzureClientID:       []byte("client-id"),
+				AzureTenantID:       []byte("tenant-id"),
+			},
+			missingKey: AzureClientSecret,
+		},
+		{
+			secret: map[string][]byte{
+				AzureStorageAccount: []byte("storage-account"),
+				AzureClientID:       []byte("client-id"),
+				AzureClientSecret:   []byte("client-secret"),
+			},
+			missingKey: AzureTenantID,
+		},
+		{
+			secret: map[string][]byte{
+				AzureSASToken: []byte("sv=2020-08-04&sig=signature"),
+			},
+			missingKey: AzureStorageAccount,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("without %s", test.missingKey), func(t *testing.T) {
+			_, err := openAZURE(context.Background(), "azblob://sample", test.secret)
+			require.EqualError(t, err, fmt.Sprintf("invalid secret: missing key: %v", test.missingKey))
+		})
+	}
+}
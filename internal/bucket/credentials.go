@@ -0,0 +1,176 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/hazelcast/platform-operator-agent/internal/k8s"
+)
+
+// Credential provider kinds, used as the scheme of the secret name, e.g. "file:/etc/bucket-secret",
+// or as the value of the CREDENTIAL_PROVIDER environment variable.
+const (
+	KubernetesProvider = "k8s"
+	FileProvider       = "file"
+	EnvProvider        = "env"
+)
+
+const (
+	// CredentialProviderEnv selects the provider for secret names without a scheme, defaults to KubernetesProvider.
+	CredentialProviderEnv = "CREDENTIAL_PROVIDER"
+	// CredentialDirEnv is the base directory for relative secret names of the FileProvider.
+	CredentialDirEnv = "CREDENTIAL_DIR"
+
+	defaultCredentialDir = "/etc/bucket-secrets"
+)
+
+// CredentialProvider reads the bucket authentication data, a key to value mapping like the data of a Kubernetes Secret.
+type CredentialProvider interface {
+	SecretData(ctx context.Context, name string) (map[string][]byte, error)
+}
+
+// SecretData reads the data of the given secret using the provider selected by the secret name scheme or by config.
+func SecretData(ctx context.Context, secretName string) (map[string][]byte, error) {
+	p, name, err := newCredentialProvider(secretName)
+	if err != nil {
+		return nil, err
+	}
+	return p.SecretData(ctx, name)
+}
+
+func newCredentialProvider(secretName string) (CredentialProvider, string, error) {
+	kind, name, ok := strings.Cut(secretName, ":")
+	if !ok {
+		// Kubernetes secret names can not contain a colon, there is no scheme
+		kind, name = os.Getenv(CredentialProviderEnv), secretName
+	}
+
+	switch kind {
+	case "", KubernetesProvider:
+		sr, err := newSecretReader()
+		if err != nil {
+			return nil, "", err
+		}
+		return sr, name, nil
+	case FileProvider:
+		baseDir := os.Getenv(CredentialDirEnv)
+		if baseDir == "" {
+			baseDir = defaultCredentialDir
+		}
+		return dirReader{baseDir: baseDir}, name, nil
+	case EnvProvider:
+		return envReader{}, name, nil
+	default:
+		return nil, "", fmt.Errorf("unknown credential provider: %v", kind)
+	}
+}
+
+// secretReader reads the secret using the Kubernetes API.
+type secretReader struct {
+	clientcorev1.SecretInterface
+}
+
+func newSecretReader() (*secretReader, error) {
+	c, err := k8s.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	ns, err := k8s.Namespace()
+	if err != nil {
+		return nil, err
+	}
+
+	return &secretReader{SecretInterface: c.CoreV1().Secrets(ns)}, nil
+}
+
+func (sr secretReader) SecretData(ctx context.Context, sn string) (map[string][]byte, error) {
+	secret, err := sr.Get(ctx, sn, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(secret.Data) == 0 {
+		return nil, fmt.Errorf("the data in the bucket authentication secret is empty: %s", secret.Name)
+	}
+
+	return secret.Data, nil
+}
+
+// dirReader reads a mounted directory with one file per key, e.g. a Secret volume
+// or a directory populated by the secrets-store CSI driver.
+type dirReader struct {
+	// baseDir is used for relative names
+	baseDir string
+}
+
+func (dr dirReader) SecretData(_ context.Context, name string) (map[string][]byte, error) {
+	dir := name
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(dr.baseDir, name)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string][]byte{}
+	for _, e := range entries {
+		// skip hidden entries, including the "..data" links of Secret volumes
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		p := filepath.Join(dir, e.Name())
+		// keys of Secret volumes are symlinks, follow them
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		value, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		data[e.Name()] = value
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("the data in the bucket authentication secret is empty: %s", dir)
+	}
+
+	return data, nil
+}
+
+// envReader reads the environment variables starting with the given prefix. The rest of the
+// variable name is the key, lower cased and with dashes, e.g. BUCKET_ACCESS_KEY_ID is access-key-id
+// for the prefix BUCKET.
+type envReader struct{}
+
+func (envReader) SecretData(_ context.Context, prefix string) (map[string][]byte, error) {
+	prefix = strings.ToUpper(strings.ReplaceAll(prefix, "-", "_")) + "_"
+
+	data := map[string][]byte{}
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(name, prefix) || name == prefix {
+			continue
+		}
+		key := strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(name, prefix), "_", "-"))
+		data[key] = []byte(value)
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("the data in the bucket authentication secret is empty: %s", strings.TrimSuffix(prefix, "_"))
+	}
+
+	return data, nil
+}
@@ -0,0 +1,105 @@
+package bucket
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirReader_SecretData(t *testing.T) {
+	// set up a directory like a mounted Secret volume
+	dir := t.TempDir()
+	secretDir := path.Join(dir, "bucket-secret")
+	dataDir := path.Join(secretDir, "..2023_01_01")
+	require.Nil(t, os.MkdirAll(dataDir, 0700))
+	require.Nil(t, os.WriteFile(path.Join(dataDir, S3AccessKeyID), []byte("<access-key-id>"), 0600))
+	require.Nil(t, os.WriteFile(path.Join(dataDir, S3Region), []byte("us-east-1"), 0600))
+	require.Nil(t, os.Symlink(dataDir, path.Join(secretDir, "..data")))
+	require.Nil(t, os.Symlink(path.Join("..data", S3AccessKeyID), path.Join(secretDir, S3AccessKeyID)))
+	require.Nil(t, os.Symlink(path.Join("..data", S3Region), path.Join(secretDir, S3Region)))
+
+	want := map[string][]byte{
+		S3AccessKeyID: []byte("<access-key-id>"),
+		S3Region:      []byte("us-east-1"),
+	}
+
+	tests := []struct {
+		name string
+		dr   dirReader
+		arg  string
+	}{
+		{"absolute path", dirReader{}, secretDir},
+		{"relative to base dir", dirReader{baseDir: dir}, "bucket-secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.dr.SecretData(context.Background(), tt.arg)
+			require.Nil(t, err)
+			require.Equal(t, want, data)
+		})
+	}
+}
+
+func TestDirReader_SecretData_Error(t *testing.T) {
+	dir := t.TempDir()
+	require.Nil(t, os.Mkdir(path.Join(dir, "empty"), 0700))
+
+	_, err := dirReader{baseDir: dir}.SecretData(context.Background(), "empty")
+	require.EqualError(t, err, "the data in the bucket authentication secret is empty: "+path.Join(dir, "empty"))
+
+	_, err = dirReader{baseDir: dir}.SecretData(context.Background(), "does-not-exist")
+	require.ErrorContains(t, err, "no such file or directory")
+}
+
+func TestEnvReader_SecretData(t *testing.T) {
+	t.Setenv("BUCKET_SECRET_ACCESS_KEY_ID", "<access-key-id>")
+	t.Setenv("BUCKET_SECRET_REGION", "us-east-1")
+	t.Setenv("OTHER_REGION", "eu-west-1")
+
+	data, err := envReader{}.SecretData(context.Background(), "bucket-secret")
+	require.Nil(t, err)
+	require.Equal(t, map[string][]byte{
+		S3AccessKeyID: []byte("<access-key-id>"),
+		S3Region:      []byte("us-east-1"),
+	}, data)
+
+	_, err = envReader{}.SecretData(context.Background(), "missing")
+	require.EqualError(t, err, "the data in the bucket authentication secret is empty: MISSING")
+}
+
+func TestNewCredentialProvider(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     string
+		dir        string
+		secretName string
+		want       CredentialProvider
+		wantName   string
+		wantErr    bool
+	}{
+		{"file scheme", "", "", "file:/etc/secret", dirReader{baseDir: defaultCredentialDir}, "/etc/secret", false},
+		{"env scheme", "", "", "env:BUCKET", envReader{}, "BUCKET", false},
+		{"scheme overrides config", EnvProvider, "", "file:secret", dirReader{baseDir: defaultCredentialDir}, "secret", false},
+		{"file from config", FileProvider, "/mnt/secrets", "secret", dirReader{baseDir: "/mnt/secrets"}, "secret", false},
+		{"env from config", EnvProvider, "", "secret", envReader{}, "secret", false},
+		{"unknown scheme", "", "", "vault:secret", nil, "", true},
+		{"unknown config", "vault", "", "secret", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(CredentialProviderEnv, tt.config)
+			t.Setenv(CredentialDirEnv, tt.dir)
+
+			p, name, err := newCredentialProvider(tt.secretName)
+			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
+			if err != nil {
+				return
+			}
+			require.Equal(t, tt.want, p)
+			require.Equal(t, tt.wantName, name)
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gocloud.dev/blob"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/verify"
+)
+
+// matchGlob reports whether the slash separated key matches the pattern. Pattern segments are matched
+// with path.Match, and a "**" segment matches any number of segments, including none.
+func matchGlob(pattern, key string) (bool, error) {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(key, "/"))
+}
+
+func matchSegments(pattern, key []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// collapse consecutive ** and try to match the rest of the pattern at each position
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true, nil
+			}
+			for i := range key {
+				ok, err := matchSegments(pattern, key[i:])
+				if ok || err != nil {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(key) == 0 {
+			return false, nil
+		}
+		ok, err := path.Match(pattern[0], key[0])
+		if !ok || err != nil {
+			return false, err
+		}
+		pattern, key = pattern[1:], key[1:]
+	}
+	return len(key) == 0, nil
+}
+
+// DownloadOptions select the objects downloaded by DownloadFiles
+type DownloadOptions struct {
+	// Recursive downloads the objects below sub-folders too, keeping their relative directories
+	Recursive bool
+	// Include are the glob patterns of the downloaded keys, e.g. "**/*.jar". All keys are included if empty.
+	Include []string
+	// Exclude are the glob patterns of the skipped keys, they take precedence over Include
+	Exclude []string
+	// MaxTotalSize is the maximum total size of the downloaded objects in bytes, unlimited if 0
+	MaxTotalSize int64
+	// Verify configures the verification of the downloaded objects, the manifest is a key of the bucket
+	Verify verify.Options
+}
+
+func (o DownloadOptions) validate() error {
+	for _, p := range append(append([]string{}, o.Include...), o.Exclude...) {
+		for _, seg := range strings.Split(p, "/") {
+			if _, err := path.Match(seg, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+// selects reports whether the object with the key is downloaded
+func (o DownloadOptions) selects(key string) bool {
+	if !o.Recursive && path.Base(key) != key {
+		return false
+	}
+	for _, p := range o.Exclude {
+		if ok, _ := matchGlob(p, key); ok {
+			return false
+		}
+	}
+	if len(o.Include) == 0 {
+		return true
+	}
+	for _, p := range o.Include {
+		if ok, _ := matchGlob(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// selectObjects lists the objects selected by the options. All objects are listed before any download,
+// so nothing is downloaded if the total size is exceeded.
+func selectObjects(ctx context.Context, b *blob.Bucket, opts DownloadOptions, v *verify.Verifier) ([]*blob.ListObject, error) {
+	var objs []*blob.ListObject
+	var total int64
+	iter := b.List(nil)
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// skip folder placeholders and keys that cannot be saved below dst
+		if obj.IsDir || strings.HasSuffix(obj.Key, "/") || !filepath.IsLocal(obj.Key) {
+			continue
+		}
+		if !opts.selects(obj.Key) || v.IsAuxiliary(obj.Key) {
+			continue
+		}
+
+		total += obj.Size
+		if opts.MaxTotalSize > 0 && total > opts.MaxTotalSize {
+			return nil, fmt.Errorf("total size of the selected objects exceeds the limit of %d bytes", opts.MaxTotalSize)
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// SyncFiles downloads the objects selected by the options that changed since the last sync, and removes the files of
+// the objects deleted from the bucket. The synced objects are recorded in the state file, other files in dst are kept.
+func SyncFiles(ctx context.Context, src, dst, secretName string, opts DownloadOptions, stateFile string) (fileutil.SyncResult, error) {
+	var res fileutil.SyncResult
+	if err := opts.validate(); err != nil {
+		return res, err
+	}
+	state, err := fileutil.LoadSyncState(stateFile)
+	if err != nil {
+		return res, fmt.Errorf("could not read the sync state: %w", err)
+	}
+
+	b, err := OpenBucket(ctx, src, secretName)
+	if err != nil {
+		return res, err
+	}
+	defer b.Close()
+
+	v, err := verify.New(ctx, opts.Verify, fetch(b))
+	if err != nil {
+		return res, err
+	}
+	objs, err := selectObjects(ctx, b, opts, v)
+	if err != nil {
+		return res, err
+	}
+
+	next := make(fileutil.SyncState, len(objs))
+	for _, obj := range objs {
+		e := fileutil.SyncEntry{File: filepath.FromSlash(obj.Key), MD5: obj.MD5, Size: obj.Size, ModTime: obj.ModTime}
+		if len(e.MD5) == 0 {
+			// objects uploaded in parts have no MD5 checksum
+			attrs, err := b.Attributes(ctx, obj.Key)
+			if err != nil {
+				return res, err
+			}
+			e.ETag = attrs.ETag
+		}
+
+		if state.UpToDate(dst, obj.Key, e) {
+			next[obj.Key] = e
+			res.Unchanged++
+			continue
+		}
+		if err = mkdirs(dst, path.Dir(obj.Key)); err != nil {
+			return res, err
+		}
+		if err = saveFile(ctx, b, obj.Key, dst, v); err != nil {
+			return res, err
+		}
+		next[obj.Key] = e
+		res.Downloaded++
+		// record the progress, an interrupted sync downloads only the remaining objects
+		if err = mergeState(state, next).Save(stateFile); err != nil {
+			return res, err
+		}
+	}
+
+	removed, err := state.RemoveDeleted(dst, next)
+	res.Removed = len(removed)
+	if err != nil {
+		return res, err
+	}
+	if err = next.Save(stateFile); err != nil {
+		return res, err
+	}
+	return res, b.Close()
+}
+
+// mergeState returns the previous state updated with the entries of the next state
+func mergeState(prev, next fileutil.SyncState) fileutil.SyncState {
+	m := make(fileutil.SyncState, len(prev)+len(next))
+	for k, e := range prev {
+		m[k] = e
+	}
+	for k, e := range next {
+		m[k] = e
+	}
+	return m
+}
@@ -0,0 +1,232 @@
+package bucket
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/verify"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{"*.jar", "a.jar", true},
+		{"*.jar", "lib/a.jar", false},
+		{"**/*.jar", "a.jar", true},
+		{"**/*.jar", "project/lib/a.jar", true},
+		{"**/*.jar", "project/README.md", false},
+		{"project/**", "project/lib/a.jar", true},
+		{"project/**", "other/a.jar", false},
+		{"**/lib/*.jar", "project/lib/a.jar", true},
+		{"**/lib/*.jar", "project/lib/nested/a.jar", false},
+		{"**/**/manifest.*", "manifest.json", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.key, func(t *testing.T) {
+			got, err := matchGlob(tt.pattern, tt.key)
+			require.Nil(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDownloadFiles_Options(t *testing.T) {
+	files := []fileutil.File{
+		{Name: "top.jar"},
+		{Name: "README.md"},
+		{Name: "project1/lib/a.jar"},
+		{Name: "project1/manifest.json"},
+		{Name: "project2/b.jar"},
+		{Name: "project2/test/b-tests.jar"},
+	}
+	tests := []struct {
+		name      string
+		opts      DownloadOptions
+		wantFiles []fileutil.File
+		wantErr   string
+	}{
+		{
+			name: "recursive",
+			opts: DownloadOptions{Recursive: true},
+			wantFiles: []fileutil.File{
+				{Name: "top.jar"},
+				{Name: "README.md"},
+				{Name: "project1", IsDir: true},
+				{Name: "project1/lib", IsDir: true},
+				{Name: "project1/lib/a.jar"},
+				{Name: "project1/manifest.json"},
+				{Name: "project2", IsDir: true},
+				{Name: "project2/b.jar"},
+				{Name: "project2/test", IsDir: true},
+				{Name: "project2/test/b-tests.jar"},
+			},
+		},
+		{
+			name: "include and exclude",
+			opts: DownloadOptions{Recursive: true, Include: []string{"**/*.jar"}, Exclude: []string{"**/test/**"}},
+			wantFiles: []fileutil.File{
+				{Name: "top.jar"},
+				{Name: "project1", IsDir: true},
+				{Name: "project1/lib", IsDir: true},
+				{Name: "project1/lib/a.jar"},
+				{Name: "project2", IsDir: true},
+				{Name: "project2/b.jar"},
+			},
+		},
+		{
+			name:      "top level only",
+			opts:      DownloadOptions{Include: []string{"**/*.jar"}},
+			wantFiles: []fileutil.File{{Name: "top.jar"}},
+		},
+		{
+			name:    "max total size",
+			opts:    DownloadOptions{Recursive: true, MaxTotalSize: 1},
+			wantErr: "total size of the selected objects exceeds the limit of 1 bytes",
+		},
+		{
+			name:    "invalid pattern",
+			opts:    DownloadOptions{Include: []string{"**/[.jar"}},
+			wantErr: `invalid pattern "**/[.jar": syntax error in pattern`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set up
+			tmpdir := t.TempDir()
+			bucketPath := path.Join(tmpdir, "bucket")
+			require.Nil(t, fileutil.CreateFiles(bucketPath, files, true))
+			for _, f := range files {
+				require.Nil(t, os.WriteFile(path.Join(bucketPath, f.Name), []byte("content"), 0600))
+			}
+			dstPath := path.Join(tmpdir, "dest")
+			require.Nil(t, os.Mkdir(dstPath, 0700))
+
+			// Run test
+			err := DownloadFiles(context.Background(), "file://"+bucketPath, dstPath, "", tt.opts)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				entries, err := os.ReadDir(dstPath)
+				require.Nil(t, err)
+				require.Empty(t, entries)
+				return
+			}
+			require.Nil(t, err)
+			got, err := fileutil.DirFileList(dstPath)
+			require.Nil(t, err)
+			require.ElementsMatch(t, tt.wantFiles, got)
+		})
+	}
+}
+
+func TestDownloadFiles_Verify(t *testing.T) {
+	sum := sha256.Sum256([]byte("content"))
+	digest := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name      string
+		checksums map[string]string
+		opts      verify.Options
+		wantFiles []fileutil.File
+		wantErr   string
+	}{
+		{
+			name:      "checksum files",
+			checksums: map[string]string{"lib/a.jar.sha256": digest, "b.jar.sha256": digest},
+			opts:      verify.Options{ChecksumFiles: true},
+			wantFiles: []fileutil.File{{Name: "lib", IsDir: true}, {Name: "lib/a.jar"}, {Name: "b.jar"}},
+		},
+		{
+			name:      "checksum file mismatch",
+			checksums: map[string]string{"lib/a.jar.sha256": digest, "b.jar.sha256": strings.Repeat("0", 64)},
+			opts:      verify.Options{ChecksumFiles: true},
+			wantErr:   "SHA-256 digest of b.jar is " + digest + ", the checksum file expects " + strings.Repeat("0", 64),
+		},
+		{
+			name:      "manifest",
+			checksums: map[string]string{"SHA256SUMS": digest + "  lib/a.jar\n" + digest + "  b.jar\n"},
+			opts:      verify.Options{Manifest: "SHA256SUMS"},
+			wantFiles: []fileutil.File{{Name: "lib", IsDir: true}, {Name: "lib/a.jar"}, {Name: "b.jar"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set up
+			tmpdir := t.TempDir()
+			bucketPath := path.Join(tmpdir, "bucket")
+			require.Nil(t, fileutil.CreateFiles(bucketPath, []fileutil.File{{Name: "lib/a.jar"}, {Name: "b.jar"}}, true))
+			for _, f := range []string{"lib/a.jar", "b.jar"} {
+				require.Nil(t, os.WriteFile(path.Join(bucketPath, f), []byte("content"), 0600))
+			}
+			for name, checksum := range tt.checksums {
+				require.Nil(t, os.WriteFile(path.Join(bucketPath, name), []byte(checksum), 0600))
+			}
+			dstPath := path.Join(tmpdir, "dest")
+			require.Nil(t, os.Mkdir(dstPath, 0700))
+
+			// Run test
+			err := DownloadFiles(context.Background(), "file://"+bucketPath, dstPath, "", DownloadOptions{Recursive: true, Verify: tt.opts})
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				require.NoFileExists(t, path.Join(dstPath, "b.jar"))
+				return
+			}
+			require.Nil(t, err)
+			got, err := fileutil.DirFileList(dstPath)
+			require.Nil(t, err)
+			require.ElementsMatch(t, tt.wantFiles, got)
+		})
+	}
+}
+
+func TestSyncFiles(t *testing.T) {
+	// Set up
+	tmpdir := t.TempDir()
+	bucketPath := path.Join(tmpdir, "bucket")
+	require.Nil(t, fileutil.CreateFiles(bucketPath, []fileutil.File{
+		{Name: "a.jar"},
+		{Name: "b.jar"},
+		{Name: "lib/c.jar"},
+	}, true))
+	for _, name := range []string{"a.jar", "b.jar", "lib/c.jar"} {
+		require.Nil(t, os.WriteFile(path.Join(bucketPath, name), []byte("content"), 0600))
+	}
+	dstPath := path.Join(tmpdir, "dest")
+	require.Nil(t, os.Mkdir(dstPath, 0700))
+	require.Nil(t, os.WriteFile(path.Join(dstPath, "local.txt"), []byte("local"), 0600))
+	stateFile := path.Join(dstPath, ".state")
+	opts := DownloadOptions{Recursive: true, Include: []string{"**/*.jar"}}
+
+	// Run test
+	res, err := SyncFiles(context.Background(), "file://"+bucketPath, dstPath, "", opts, stateFile)
+	require.Nil(t, err)
+	require.Equal(t, fileutil.SyncResult{Downloaded: 3}, res)
+
+	res, err = SyncFiles(context.Background(), "file://"+bucketPath, dstPath, "", opts, stateFile)
+	require.Nil(t, err)
+	require.Equal(t, fileutil.SyncResult{Unchanged: 3}, res)
+
+	// change a.jar, delete lib/c.jar
+	require.Nil(t, os.WriteFile(path.Join(bucketPath, "a.jar"), []byte("new content"), 0600))
+	require.Nil(t, os.Remove(path.Join(bucketPath, "lib/c.jar")))
+	res, err = SyncFiles(context.Background(), "file://"+bucketPath, dstPath, "", opts, stateFile)
+	require.Nil(t, err)
+	require.Equal(t, fileutil.SyncResult{Downloaded: 1, Unchanged: 1, Removed: 1}, res)
+
+	got, err := fileutil.DirFileList(dstPath)
+	require.Nil(t, err)
+	require.ElementsMatch(t, []fileutil.File{{Name: "a.jar"}, {Name: "b.jar"}, {Name: "local.txt"}, {Name: ".state"}}, got)
+	content, err := os.ReadFile(path.Join(dstPath, "a.jar"))
+	require.Nil(t, err)
+	require.Equal(t, "new content", string(content))
+}
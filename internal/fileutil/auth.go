@@ -0,0 +1,71 @@
+package fileutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// Keys of the secret with the credentials of URL downloads
+const (
+	URLUsernameSecretKey = "username"
+	URLPasswordSecretKey = "password"
+	URLTokenSecretKey    = "token"
+	// URLHeadersSecretKey holds arbitrary headers, one "Name: value" per line
+	URLHeadersSecretKey = "headers"
+)
+
+// HeaderFromSecret returns the request header with the credentials of the secret, which has either basic auth
+// credentials or a bearer token, and optionally arbitrary headers. The errors never contain secret values.
+func HeaderFromSecret(secret map[string][]byte) (http.Header, error) {
+	header := http.Header{}
+	if data, ok := secret[URLHeadersSecretKey]; ok {
+		if err := parseHeaders(data, header); err != nil {
+			return nil, err
+		}
+	}
+
+	user, hasUser := secret[URLUsernameSecretKey]
+	token, hasToken := secret[URLTokenSecretKey]
+	switch {
+	case hasUser && hasToken:
+		return nil, fmt.Errorf("invalid secret: both %v and %v are set", URLUsernameSecretKey, URLTokenSecretKey)
+	case hasUser:
+		password, ok := secret[URLPasswordSecretKey]
+		if !ok {
+			return nil, fmt.Errorf("invalid secret: missing key: %v", URLPasswordSecretKey)
+		}
+		auth := base64.StdEncoding.EncodeToString([]byte(string(user) + ":" + string(password)))
+		header.Set("Authorization", "Basic "+auth)
+	case hasToken:
+		header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	if len(header) == 0 {
+		return nil, fmt.Errorf("invalid secret: none of the keys %v, %v or %v is set",
+			URLUsernameSecretKey, URLTokenSecretKey, URLHeadersSecretKey)
+	}
+	return header, nil
+}
+
+func parseHeaders(data []byte, header http.Header) error {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(text, ":")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" || strings.ContainsAny(k, " \t") {
+			// the line is not printed, it may contain a secret
+			return fmt.Errorf("invalid secret: invalid header on line %d of %v", line, URLHeadersSecretKey)
+		}
+		header.Add(textproto.CanonicalMIMEHeaderKey(k), strings.TrimSpace(v))
+	}
+	return s.Err()
+}
@@ -0,0 +1,96 @@
+package fileutil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderFromSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  map[string][]byte
+		want    http.Header
+		wantErr string
+	}{
+		{
+			name:   "basic auth",
+			secret: map[string][]byte{URLUsernameSecretKey: []byte("user"), URLPasswordSecretKey: []byte("pass")},
+			want:   http.Header{"Authorization": {"Basic dXNlcjpwYXNz"}},
+		},
+		{
+			name:   "bearer token",
+			secret: map[string][]byte{URLTokenSecretKey: []byte("<token>\n")},
+			want:   http.Header{"Authorization": {"Bearer <token>"}},
+		},
+		{
+			name:   "headers",
+			secret: map[string][]byte{URLHeadersSecretKey: []byte("# artifactory\nx-jfrog-art-api: <key>\n\nX-Extra: a: b\n")},
+			want:   http.Header{"X-Jfrog-Art-Api": {"<key>"}, "X-Extra": {"a: b"}},
+		},
+		{
+			name:   "token and headers",
+			secret: map[string][]byte{URLTokenSecretKey: []byte("<token>"), URLHeadersSecretKey: []byte("X-Extra: value")},
+			want:   http.Header{"Authorization": {"Bearer <token>"}, "X-Extra": {"value"}},
+		},
+		{
+			name:    "missing password",
+			secret:  map[string][]byte{URLUsernameSecretKey: []byte("user")},
+			wantErr: "invalid secret: missing key: password",
+		},
+		{
+			name:    "username and token",
+			secret:  map[string][]byte{URLUsernameSecretKey: []byte("user"), URLPasswordSecretKey: []byte("pass"), URLTokenSecretKey: []byte("<token>")},
+			wantErr: "invalid secret: both username and token are set",
+		},
+		{
+			name:    "invalid header",
+			secret:  map[string][]byte{URLHeadersSecretKey: []byte("X-Extra: value\n<secret>\n")},
+			wantErr: "invalid secret: invalid header on line 2 of headers",
+		},
+		{
+			name:    "no credentials",
+			secret:  map[string][]byte{"other": []byte("value")},
+			wantErr: "invalid secret: none of the keys username, token or headers is set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := HeaderFromSecret(tt.secret)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHTTPClient_WithHeader(t *testing.T) {
+	// Set up
+	var otherHeader http.Header
+	other := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		otherHeader = r.Header
+	}))
+	defer other.Close()
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		http.Redirect(w, r, other.URL, http.StatusFound)
+	}))
+	defer srv.Close()
+	c := NewHTTPClient(DefaultHTTPOptions).WithHeader(http.Header{"X-Api-Key": {"<key>"}})
+
+	// Run test
+	resp, err := c.Get(context.Background(), srv.URL, nil)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "<key>", header.Get("X-Api-Key"))
+	// the header is not sent to other hosts
+	require.Empty(t, otherHeader.Get("X-Api-Key"))
+}
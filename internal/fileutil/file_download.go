@@ -7,14 +7,19 @@ import (
 	"io"
 	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+
+	"github.com/hazelcast/platform-operator-agent/internal/verify"
 )
 
 var (
 	ErrNoFilename = errors.New("no file exists")
+	// ErrDeleted is returned by SyncFileFromURL when a previously synced file is gone from the server
+	ErrDeleted = errors.New("file was deleted")
 )
 
 func init() {
@@ -25,9 +30,10 @@ func init() {
 	}
 }
 
-func DownloadFileFromURL(ctx context.Context, srcURL, dstFolder string) error {
+// DownloadFileFromURL downloads the file into dstFolder, it is placed only if the verifier accepts it
+func DownloadFileFromURL(ctx context.Context, c *HTTPClient, srcURL, dstFolder string, v *verify.Verifier) error {
 	// Get the data
-	resp, err := http.Get(srcURL)
+	resp, err := c.Get(ctx, srcURL, nil)
 	if err != nil {
 		return err
 	}
@@ -44,25 +50,77 @@ func DownloadFileFromURL(ctx context.Context, srcURL, dstFolder string) error {
 		return ErrNoFilename
 	}
 
-	// Create the file
-	out, err := os.Create(path.Join(dstFolder, fileName))
+	return verify.SaveFile(ctx, v, srcURL, fileName, resp.Body, path.Join(dstFolder, fileName))
+}
+
+// SyncFileFromURL downloads the file into dstFolder unless it is unchanged since the previous sync. The request is
+// conditional on the ETag and the modification time of the previous entry, if its file still exists. It returns the
+// entry of the file and whether it was downloaded. A 404 or 410 response for a previously synced file returns ErrDeleted.
+// If the file name changed, the previous file is removed by SyncState.RemoveDeleted.
+func SyncFileFromURL(ctx context.Context, c *HTTPClient, srcURL, dstFolder string, prev SyncEntry, v *verify.Verifier) (SyncEntry, bool, error) {
+	header := http.Header{}
+	if prev.File != "" && filepath.IsLocal(prev.File) {
+		if _, err := os.Stat(filepath.Join(dstFolder, prev.File)); err == nil {
+			if prev.ETag != "" {
+				header.Set("If-None-Match", prev.ETag)
+			}
+			if !prev.ModTime.IsZero() {
+				header.Set("If-Modified-Since", prev.ModTime.UTC().Format(http.TimeFormat))
+			}
+		}
+	}
+
+	resp, err := c.Get(ctx, srcURL, header)
 	if err != nil {
-		return err
+		return SyncEntry{}, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return prev, false, nil
+	}
+	// a URL that never synced is not reported as deleted, e.g. if it is misconfigured
+	if c := resp.StatusCode; prev.File != "" && (c == http.StatusNotFound || c == http.StatusGone) {
+		return SyncEntry{}, false, fmt.Errorf("%w, status code is %d", ErrDeleted, c)
+	}
+	if c := resp.StatusCode; c < 200 || 299 < c {
+		return SyncEntry{}, false, fmt.Errorf("error downloading file, status code is %d", c)
 	}
-	defer out.Close()
 
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
+	fileName := guessFilename(resp)
+	if fileName == "" {
+		return SyncEntry{}, false, ErrNoFilename
+	}
+	e := SyncEntry{File: fileName, ETag: resp.Header.Get("ETag"), Size: resp.ContentLength}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		e.ModTime = t
+	}
+
+	if err = verify.SaveFile(ctx, v, srcURL, fileName, resp.Body, path.Join(dstFolder, fileName)); err != nil {
+		return SyncEntry{}, false, err
+	}
+	return e, true, nil
+}
+
+// Fetch reads the companion files of the verifier, the suffix is appended to the URL path
+func (c *HTTPClient) Fetch(ctx context.Context, srcURL, suffix string) ([]byte, error) {
+	u, err := url.Parse(srcURL)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	u.Path += suffix
+	u.RawPath = ""
 
-	// flush file
-	if err = out.Sync(); err != nil {
-		return err
+	resp, err := c.Get(ctx, u.String(), nil)
+	if err != nil {
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	return nil
+	if code := resp.StatusCode; code < 200 || 299 < code {
+		return nil, fmt.Errorf("error downloading %s, status code is %d", path.Base(u.Path), code)
+	}
+	return io.ReadAll(resp.Body)
 }
 
 // Code snippet taken from https://github.com/cavaliergopher/grab/blob/v3.0.1/v3/util.go
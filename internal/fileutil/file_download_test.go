@@ -92,7 +92,7 @@ func TestDownloadFileFromURL(t *testing.T) {
 				AnyResponse(200, nil, tt.content.contentType, tt.content.contentDispFileName))
 
 			// Run the tests
-			err = DownloadFileFromURL(context.Background(), tt.url, dstPath)
+			err = DownloadFileFromURL(context.Background(), NewHTTPClient(DefaultHTTPOptions), tt.url, dstPath, nil)
 			require.Equal(t, tt.wantErr, err, "Error is: ", err)
 			if err != nil {
 				return
@@ -153,7 +153,7 @@ func TestDownloadFileFromURL_DestinationPath(t *testing.T) {
 				AnyResponse(200, nil, tt.content.contentType, tt.content.contentDispFileName))
 
 			// Run the tests
-			err = DownloadFileFromURL(context.Background(), tt.url, dstPath)
+			err = DownloadFileFromURL(context.Background(), NewHTTPClient(DefaultHTTPOptions), tt.url, dstPath, nil)
 			require.Equal(t, tt.wantErr, err != nil, "Error is: ", err)
 			if err != nil {
 				require.ErrorContains(t, err, "no such file or directory")
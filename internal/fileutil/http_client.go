@@ -0,0 +1,279 @@
+package fileutil
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+
+	"github.com/hazelcast/platform-operator-agent/internal/uri"
+)
+
+const (
+	defaultBackoff = time.Second
+	maxBackoff     = 30 * time.Second
+	// maxRetryAfter caps the delay requested by the Retry-After header
+	maxRetryAfter = 5 * time.Minute
+)
+
+// ErrTooLarge is returned when a response exceeds the maximum size
+var ErrTooLarge = errors.New("response is too large")
+
+// HTTPOptions configure the HTTP client of the URL downloads. Zero values are replaced with the default options,
+// negative values disable the timeouts and the retries.
+type HTTPOptions struct {
+	// ConnectTimeout limits establishing the connection and the TLS handshake
+	ConnectTimeout time.Duration
+	// Timeout limits a whole download including the retries
+	Timeout time.Duration
+	// Retries is the number of retries on network errors and 5xx responses
+	Retries int
+	// MaxSize is the maximum size of a response body in bytes, unlimited if 0
+	MaxSize int64
+	// Header is sent with every request, e.g. the credentials of the server
+	Header http.Header
+	// TLSConfig has the CA bundle and the client certificate, the system roots are used if nil
+	TLSConfig *tls.Config
+}
+
+// DefaultHTTPOptions are used when no options are configured
+var DefaultHTTPOptions = HTTPOptions{
+	ConnectTimeout: 30 * time.Second,
+	Timeout:        10 * time.Minute,
+	Retries:        3,
+}
+
+// withDefaults replaces the zero values with the default options, e.g. of commands from the compound config
+func (o HTTPOptions) withDefaults() HTTPOptions {
+	if o.ConnectTimeout == 0 {
+		o.ConnectTimeout = DefaultHTTPOptions.ConnectTimeout
+	}
+	if o.Timeout == 0 {
+		o.Timeout = DefaultHTTPOptions.Timeout
+	}
+	if o.Retries == 0 {
+		o.Retries = DefaultHTTPOptions.Retries
+	}
+	return o
+}
+
+// HTTPClient downloads URLs with timeouts, retries and a size limit
+type HTTPClient struct {
+	client  *http.Client
+	opts    HTTPOptions
+	backoff time.Duration
+}
+
+// NewHTTPClient returns a client using the default transport with the connect timeout and the TLS config of
+// the options. Requests are sent through the proxy of the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+func NewHTTPClient(opts HTTPOptions) *HTTPClient {
+	opts = opts.withDefaults()
+	transport := http.DefaultTransport
+	// the default transport is replaced in tests
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		t = t.Clone()
+		// read the environment for every client, http.ProxyFromEnvironment reads it only once
+		proxy := httpproxy.FromEnvironment().ProxyFunc()
+		t.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxy(req.URL)
+		}
+		if opts.ConnectTimeout > 0 {
+			d := &net.Dialer{Timeout: opts.ConnectTimeout, KeepAlive: 30 * time.Second}
+			t.DialContext = d.DialContext
+			t.TLSHandshakeTimeout = opts.ConnectTimeout
+		}
+		if opts.TLSConfig != nil {
+			t.TLSClientConfig = opts.TLSConfig.Clone()
+		}
+		transport = t
+	}
+	return &HTTPClient{
+		client:  newClient(transport, opts.Header),
+		opts:    opts,
+		backoff: defaultBackoff,
+	}
+}
+
+// WithHeader returns a client sending the header with every request, in addition to the header of the options
+func (c *HTTPClient) WithHeader(header http.Header) *HTTPClient {
+	opts := c.opts
+	opts.Header = opts.Header.Clone()
+	if opts.Header == nil {
+		opts.Header = http.Header{}
+	}
+	for k, v := range header {
+		opts.Header[k] = v
+	}
+	return &HTTPClient{
+		client:  newClient(c.client.Transport, opts.Header),
+		opts:    opts,
+		backoff: c.backoff,
+	}
+}
+
+// WithTLSConfig returns a client with a new transport using the TLS config
+func (c *HTTPClient) WithTLSConfig(cfg *tls.Config) *HTTPClient {
+	opts := c.opts
+	opts.TLSConfig = cfg
+	n := NewHTTPClient(opts)
+	n.backoff = c.backoff
+	return n
+}
+
+// newClient returns a client which does not send the header to other hosts when following redirects
+func newClient(transport http.RoundTripper, header http.Header) *http.Client {
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if req.URL.Host != via[0].URL.Host {
+				for k := range header {
+					req.Header.Del(k)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// Get sends a GET request with the header, retrying on network errors, 429 and 5xx responses. The response of
+// the last attempt is returned, its body is limited to the maximum size and must be closed.
+func (c *HTTPClient) Get(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	cancel := func() {}
+	if c.opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		for _, h := range []http.Header{c.opts.Header, header} {
+			for k, v := range h {
+				req.Header[k] = v
+			}
+		}
+
+		resp, err := c.client.Do(req)
+		err = redactError(err)
+		last := attempt >= c.opts.Retries
+		switch {
+		case err != nil:
+			if last || ctx.Err() != nil {
+				cancel()
+				return nil, err
+			}
+		case retryable(resp.StatusCode) && !last:
+			// the connection is reused if the body is read
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		default:
+			if c.opts.MaxSize > 0 && resp.ContentLength > c.opts.MaxSize {
+				resp.Body.Close()
+				cancel()
+				return nil, fmt.Errorf("%w: %d bytes exceed the limit of %d bytes", ErrTooLarge, resp.ContentLength, c.opts.MaxSize)
+			}
+			resp.Body = &limitedBody{ReadCloser: resp.Body, max: c.opts.MaxSize, cancel: cancel}
+			return resp, nil
+		}
+
+		if err = sleep(ctx, c.delay(attempt, resp)); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+}
+
+// delay returns the Retry-After delay of the response, or the exponential backoff of the attempt
+func (c *HTTPClient) delay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if d, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return d
+		}
+	}
+	d := c.backoff << attempt
+	if d <= 0 || d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
+
+// redactError removes the query and the user info from the URL of the error, they may hold credentials
+func redactError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = uri.Redact(urlErr.URL)
+	}
+	return err
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// retryAfter parses the Retry-After header, in seconds or as an HTTP date
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	var d time.Duration
+	if s, err := strconv.Atoi(v); err == nil {
+		d = time.Duration(s) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = t.Sub(now)
+	} else {
+		return 0, false
+	}
+	if d < 0 {
+		d = 0
+	}
+	if d > maxRetryAfter {
+		d = maxRetryAfter
+	}
+	return d, true
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// limitedBody fails reading more than max bytes, and releases the timeout of the request when closed
+type limitedBody struct {
+	io.ReadCloser
+	max    int64
+	n      int64
+	cancel context.CancelFunc
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if b.max > 0 && b.n > b.max {
+		return n, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, b.max)
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,183 @@
+package fileutil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPClient_Get(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         HTTPOptions
+		statuses     []int
+		retryAfter   string
+		body         string
+		wantStatus   int
+		wantRequests int
+		wantErr      error
+	}{
+		{
+			name:         "retries 5xx",
+			opts:         HTTPOptions{Retries: 3},
+			statuses:     []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK},
+			body:         "content",
+			wantStatus:   http.StatusOK,
+			wantRequests: 3,
+		},
+		{
+			name:         "honors Retry-After",
+			opts:         HTTPOptions{Retries: 1},
+			statuses:     []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter:   "0",
+			body:         "content",
+			wantStatus:   http.StatusOK,
+			wantRequests: 2,
+		},
+		{
+			name:         "returns the last response",
+			opts:         HTTPOptions{Retries: 1},
+			statuses:     []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK},
+			wantStatus:   http.StatusInternalServerError,
+			wantRequests: 2,
+		},
+		{
+			name:         "does not retry 4xx",
+			opts:         HTTPOptions{Retries: 3},
+			statuses:     []int{http.StatusNotFound},
+			wantStatus:   http.StatusNotFound,
+			wantRequests: 1,
+		},
+		{
+			name:         "max size",
+			opts:         HTTPOptions{MaxSize: 4},
+			statuses:     []int{http.StatusOK},
+			body:         "content",
+			wantRequests: 1,
+			wantErr:      ErrTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set up
+			var requests int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				status := tt.statuses[requests]
+				requests++
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			c := NewHTTPClient(tt.opts)
+			c.backoff = time.Millisecond
+
+			// Run test
+			resp, err := c.Get(context.Background(), srv.URL, nil)
+			require.Equal(t, tt.wantRequests, requests)
+			if tt.wantErr != nil {
+				require.True(t, errors.Is(err, tt.wantErr), "Error is: ", err)
+				return
+			}
+			require.Nil(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, tt.wantStatus, resp.StatusCode)
+			if tt.wantStatus == http.StatusOK {
+				body, err := io.ReadAll(resp.Body)
+				require.Nil(t, err)
+				require.Equal(t, tt.body, string(body))
+			}
+		})
+	}
+}
+
+func TestHTTPClient_Get_MaxSizeStreamed(t *testing.T) {
+	// Set up
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// without a Content-Length the size is checked while reading
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer srv.Close()
+
+	// Run test
+	resp, err := NewHTTPClient(HTTPOptions{MaxSize: 10}).Get(context.Background(), srv.URL, nil)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	_, err = io.ReadAll(resp.Body)
+	require.True(t, errors.Is(err, ErrTooLarge), "Error is: ", err)
+}
+
+func TestHTTPClient_Get_Timeout(t *testing.T) {
+	// Set up
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	// Run test
+	c := NewHTTPClient(HTTPOptions{Timeout: 50 * time.Millisecond, Retries: 3})
+	_, err := c.Get(context.Background(), srv.URL, nil)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "Error is: ", err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewHTTPClient(HTTPOptions{Retries: 3}).Get(ctx, srv.URL, nil)
+	require.True(t, errors.Is(err, context.Canceled), "Error is: ", err)
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2022, 7, 29, 0, 10, 0, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"3600", maxRetryAfter, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := retryAfter(tt.value, now)
+			require.Equal(t, tt.wantOk, ok)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHTTPOptions_WithDefaults(t *testing.T) {
+	require.Equal(t, DefaultHTTPOptions, HTTPOptions{}.withDefaults())
+
+	disabled := HTTPOptions{ConnectTimeout: time.Second, Timeout: -1, Retries: -1, MaxSize: 10}
+	require.Equal(t, disabled, disabled.withDefaults())
+}
+
+func TestHTTPClient_Get_RedactsErrors(t *testing.T) {
+	// Set up
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	// Run test
+	_, err := NewHTTPClient(HTTPOptions{Retries: -1}).Get(context.Background(), "http://user:pass@"+srv.Listener.Addr().String()+"/lib.jar?signature=secret", nil)
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "secret")
+	require.NotContains(t, err.Error(), "pass")
+}
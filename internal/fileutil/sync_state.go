@@ -0,0 +1,116 @@
+package fileutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SyncEntry identifies the version of a synced file at its source
+type SyncEntry struct {
+	// File is the path of the downloaded file relative to the destination
+	File    string    `json:"file"`
+	ETag    string    `json:"etag,omitempty"`
+	MD5     []byte    `json:"md5,omitempty"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime,omitempty"`
+}
+
+// Unchanged reports whether the entries are the same version, compared by the MD5 checksum or the ETag if
+// both entries have one, and by the modification time otherwise.
+func (e SyncEntry) Unchanged(o SyncEntry) bool {
+	if e.File != o.File || e.Size != o.Size {
+		return false
+	}
+	switch {
+	case len(e.MD5) > 0 && len(o.MD5) > 0:
+		return bytes.Equal(e.MD5, o.MD5)
+	case e.ETag != "" && o.ETag != "":
+		return e.ETag == o.ETag
+	default:
+		return !e.ModTime.IsZero() && e.ModTime.Equal(o.ModTime)
+	}
+}
+
+// SyncState records the synced files by their source key or URL
+type SyncState map[string]SyncEntry
+
+// LoadSyncState reads the state file, the state is empty if it does not exist
+func LoadSyncState(name string) (SyncState, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return SyncState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := SyncState{}
+	if err = json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save writes the state file atomically
+func (s SyncState) Save(name string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// UpToDate reports whether the file of the key is unchanged and still present in the destination
+func (s SyncState) UpToDate(dst, key string, e SyncEntry) bool {
+	prev, ok := s[key]
+	if !ok || !prev.Unchanged(e) {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(dst, e.File))
+	return err == nil
+}
+
+// RemoveDeleted removes the files, which are not in the next state, and their empty parent directories below dst.
+// These are the files of the deleted keys and the previous files of the keys whose file name changed, e.g. by the
+// Content-Disposition of a URL. It returns the removed files.
+func (s SyncState) RemoveDeleted(dst string, next SyncState) ([]string, error) {
+	kept := map[string]bool{}
+	for _, e := range next {
+		kept[e.File] = true
+	}
+
+	var removed []string
+	for _, e := range s {
+		// the state file is not trusted to name files outside of dst
+		if kept[e.File] || !filepath.IsLocal(e.File) {
+			continue
+		}
+		err := os.Remove(filepath.Join(dst, e.File))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, err
+		}
+		removed = append(removed, e.File)
+		for dir := filepath.Dir(e.File); dir != "."; dir = filepath.Dir(dir) {
+			// fails if the directory is not empty
+			if os.Remove(filepath.Join(dst, dir)) != nil {
+				break
+			}
+		}
+	}
+	return removed, nil
+}
+
+// SyncResult counts the files of a sync
+type SyncResult struct {
+	Downloaded int
+	Unchanged  int
+	Removed    int
+}
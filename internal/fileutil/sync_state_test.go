@@ -0,0 +1,135 @@
+package fileutil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncEntry_Unchanged(t *testing.T) {
+	modTime := time.Date(2022, 7, 29, 0, 10, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		a, b SyncEntry
+		want bool
+	}{
+		{"same md5", SyncEntry{File: "a", Size: 1, MD5: []byte{1}, ETag: "x"}, SyncEntry{File: "a", Size: 1, MD5: []byte{1}, ETag: "y"}, true},
+		{"different md5", SyncEntry{File: "a", Size: 1, MD5: []byte{1}}, SyncEntry{File: "a", Size: 1, MD5: []byte{2}}, false},
+		{"same etag", SyncEntry{File: "a", Size: 1, ETag: "x"}, SyncEntry{File: "a", Size: 1, ETag: "x"}, true},
+		{"different etag", SyncEntry{File: "a", Size: 1, ETag: "x"}, SyncEntry{File: "a", Size: 1, ETag: "y"}, false},
+		{"different size", SyncEntry{File: "a", Size: 1, ETag: "x"}, SyncEntry{File: "a", Size: 2, ETag: "x"}, false},
+		{"different file", SyncEntry{File: "a", Size: 1, ETag: "x"}, SyncEntry{File: "b", Size: 1, ETag: "x"}, false},
+		{"same mod time", SyncEntry{File: "a", ModTime: modTime}, SyncEntry{File: "a", ModTime: modTime}, true},
+		{"no version", SyncEntry{File: "a"}, SyncEntry{File: "a"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.a.Unchanged(tt.b))
+		})
+	}
+}
+
+func TestSyncState(t *testing.T) {
+	// Set up
+	dst := t.TempDir()
+	require.Nil(t, CreateFiles(dst, []File{
+		{Name: "a.jar"},
+		{Name: "lib/b.jar"},
+		{Name: "keep.jar"},
+	}, true))
+	name := path.Join(dst, ".state")
+
+	// Run test
+	s, err := LoadSyncState(name)
+	require.Nil(t, err)
+	require.Empty(t, s)
+
+	s = SyncState{
+		"a":      {File: "a.jar", ETag: "1"},
+		"b":      {File: "lib/b.jar", ETag: "1"},
+		"escape": {File: "../outside.jar", ETag: "1"},
+	}
+	require.Nil(t, s.Save(name))
+	s, err = LoadSyncState(name)
+	require.Nil(t, err)
+	require.True(t, s.UpToDate(dst, "a", SyncEntry{File: "a.jar", ETag: "1"}))
+	require.False(t, s.UpToDate(dst, "a", SyncEntry{File: "a.jar", ETag: "2"}))
+	require.False(t, s.UpToDate(dst, "c", SyncEntry{File: "c.jar", ETag: "1"}))
+
+	removed, err := s.RemoveDeleted(dst, SyncState{"a": {File: "a.jar", ETag: "2"}})
+	require.Nil(t, err)
+	require.Equal(t, []string{"lib/b.jar"}, removed)
+	got, err := DirFileList(dst)
+	require.Nil(t, err)
+	require.ElementsMatch(t, []File{{Name: "a.jar"}, {Name: "keep.jar"}, {Name: ".state"}}, got)
+
+	// the previous file of a renamed key is removed
+	require.Nil(t, CreateFiles(dst, []File{{Name: "a-2.jar"}}, false))
+	s = SyncState{"a": {File: "a.jar", ETag: "2"}}
+	removed, err = s.RemoveDeleted(dst, SyncState{"a": {File: "a-2.jar", ETag: "3"}})
+	require.Nil(t, err)
+	require.Equal(t, []string{"a.jar"}, removed)
+	require.NoFileExists(t, path.Join(dst, "a.jar"))
+}
+
+func TestSyncFileFromURL(t *testing.T) {
+	// Set up
+	modTime := time.Date(2022, 7, 29, 0, 10, 0, 0, time.UTC)
+	content := "content"
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", `"`+content+`"`)
+		http.ServeContent(w, r, "file.jar", modTime, strings.NewReader(content))
+	}))
+	defer srv.Close()
+	dst := t.TempDir()
+	c := NewHTTPClient(DefaultHTTPOptions)
+
+	// Run test
+	e, downloaded, err := SyncFileFromURL(context.Background(), c, srv.URL+"/file.jar", dst, SyncEntry{}, nil)
+	require.Nil(t, err)
+	require.True(t, downloaded)
+	require.Equal(t, SyncEntry{File: "file.jar", ETag: `"content"`, Size: 7, ModTime: modTime}, e)
+
+	// not modified
+	got, downloaded, err := SyncFileFromURL(context.Background(), c, srv.URL+"/file.jar", dst, e, nil)
+	require.Nil(t, err)
+	require.False(t, downloaded)
+	require.Equal(t, e, got)
+
+	// changed
+	content = "new content"
+	got, downloaded, err = SyncFileFromURL(context.Background(), c, srv.URL+"/file.jar", dst, e, nil)
+	require.Nil(t, err)
+	require.True(t, downloaded)
+	require.Equal(t, `"new content"`, got.ETag)
+	data, err := os.ReadFile(path.Join(dst, "file.jar"))
+	require.Nil(t, err)
+	require.Equal(t, content, string(data))
+
+	// the missing file is downloaded again
+	require.Nil(t, os.Remove(path.Join(dst, "file.jar")))
+	_, downloaded, err = SyncFileFromURL(context.Background(), c, srv.URL+"/file.jar", dst, got, nil)
+	require.Nil(t, err)
+	require.True(t, downloaded)
+	require.Equal(t, 4, requests)
+
+	// deleted from the server
+	srv.Config.Handler = http.NotFoundHandler()
+	_, _, err = SyncFileFromURL(context.Background(), c, srv.URL+"/file.jar", dst, got, nil)
+	require.True(t, errors.Is(err, ErrDeleted), "Error is: ", err)
+
+	// a file which was never synced is not deleted
+	_, _, err = SyncFileFromURL(context.Background(), c, srv.URL+"/file.jar", dst, SyncEntry{}, nil)
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrDeleted))
+}
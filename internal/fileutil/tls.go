@@ -0,0 +1,83 @@
+package fileutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// Keys of the secret with the CA bundle and the client certificate of URL downloads
+const (
+	URLCABundleSecretKey   = "ca-bundle"
+	URLClientCertSecretKey = "client-cert"
+	URLClientKeySecretKey  = "client-key"
+)
+
+// TLSFiles are the mounted paths of the CA bundle and the client certificate in PEM format
+type TLSFiles struct {
+	CA   string
+	Cert string
+	Key  string
+}
+
+// IsSet reports whether any of the paths is set
+func (f TLSFiles) IsSet() bool {
+	return f.CA != "" || f.Cert != "" || f.Key != ""
+}
+
+// Read returns the content of the files by the secret keys
+func (f TLSFiles) Read() (map[string][]byte, error) {
+	data := map[string][]byte{}
+	for key, name := range map[string]string{
+		URLCABundleSecretKey:   f.CA,
+		URLClientCertSecretKey: f.Cert,
+		URLClientKeySecretKey:  f.Key,
+	} {
+		if name == "" {
+			continue
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		data[key] = b
+	}
+	return data, nil
+}
+
+// TLSConfigFromSecret returns the TLS config with the CA bundle, which is trusted in addition to the system roots,
+// and the client certificate of the secret
+func TLSConfigFromSecret(secret map[string][]byte) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	ca, hasCA := secret[URLCABundleSecretKey]
+	if hasCA {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if ok := pool.AppendCertsFromPEM(ca); !ok {
+			return nil, fmt.Errorf("invalid secret: no PEM certificates found in key: %v", URLCABundleSecretKey)
+		}
+		cfg.RootCAs = pool
+	}
+
+	cert, hasCert := secret[URLClientCertSecretKey]
+	key, hasKey := secret[URLClientKeySecretKey]
+	switch {
+	case hasCert && hasKey:
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	case hasCert:
+		return nil, fmt.Errorf("invalid secret: missing key: %v", URLClientKeySecretKey)
+	case hasKey:
+		return nil, fmt.Errorf("invalid secret: missing key: %v", URLClientCertSecretKey)
+	case !hasCA:
+		return nil, fmt.Errorf("invalid secret: none of the keys %v or %v is set", URLCABundleSecretKey, URLClientCertSecretKey)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,146 @@
+package fileutil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSConfigFromSecret(t *testing.T) {
+	cert, key := clientCertificate(t)
+	tests := []struct {
+		name    string
+		secret  map[string][]byte
+		wantErr string
+	}{
+		{
+			name:   "client certificate",
+			secret: map[string][]byte{URLClientCertSecretKey: cert, URLClientKeySecretKey: key},
+		},
+		{
+			name:    "missing key",
+			secret:  map[string][]byte{URLClientCertSecretKey: cert},
+			wantErr: "invalid secret: missing key: client-key",
+		},
+		{
+			name:    "missing certificate",
+			secret:  map[string][]byte{URLClientKeySecretKey: key},
+			wantErr: "invalid secret: missing key: client-cert",
+		},
+		{
+			name:    "invalid CA bundle",
+			secret:  map[string][]byte{URLCABundleSecretKey: []byte("not a certificate")},
+			wantErr: "invalid secret: no PEM certificates found in key: ca-bundle",
+		},
+		{
+			name:    "no keys",
+			secret:  map[string][]byte{"other": []byte("value")},
+			wantErr: "invalid secret: none of the keys ca-bundle or client-cert is set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := TLSConfigFromSecret(tt.secret)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.Nil(t, err)
+			require.Len(t, cfg.Certificates, 1)
+		})
+	}
+}
+
+func TestHTTPClient_MutualTLS(t *testing.T) {
+	// Set up
+	cert, key := clientCertificate(t)
+	clientCAs := x509.NewCertPool()
+	require.True(t, clientCAs.AppendCertsFromPEM(cert))
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("content"))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	files := TLSFiles{CA: path.Join(dir, "ca.crt"), Cert: path.Join(dir, "tls.crt"), Key: path.Join(dir, "tls.key")}
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.Nil(t, os.WriteFile(files.CA, ca, 0600))
+	require.Nil(t, os.WriteFile(files.Cert, cert, 0600))
+	require.Nil(t, os.WriteFile(files.Key, key, 0600))
+
+	// Run test
+	_, err := NewHTTPClient(HTTPOptions{Retries: -1}).Get(context.Background(), srv.URL, nil)
+	require.Error(t, err, "the server certificate is not trusted")
+
+	data, err := files.Read()
+	require.Nil(t, err)
+	cfg, err := TLSConfigFromSecret(data)
+	require.Nil(t, err)
+	resp, err := NewHTTPClient(HTTPOptions{}).WithTLSConfig(cfg).Get(context.Background(), srv.URL, nil)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, "content", string(body))
+}
+
+func TestHTTPClient_Proxy(t *testing.T) {
+	// Set up
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.Host)
+		_, _ = w.Write([]byte("content"))
+	}))
+	defer proxy.Close()
+	t.Setenv("HTTP_PROXY", proxy.URL)
+	t.Setenv("NO_PROXY", "internal.invalid")
+
+	// Run test
+	resp, err := NewHTTPClient(HTTPOptions{}).Get(context.Background(), "http://artifacts.invalid/code.jar", nil)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, []string{"artifacts.invalid"}, proxied)
+
+	_, err = NewHTTPClient(HTTPOptions{Timeout: 5 * time.Second, Retries: -1}).Get(context.Background(), "http://internal.invalid/code.jar", nil)
+	require.Error(t, err)
+	require.Equal(t, []string{"artifacts.invalid"}, proxied)
+}
+
+// clientCertificate returns a self-signed client certificate and its key in PEM format
+func clientCertificate(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "agent"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
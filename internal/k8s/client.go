@@ -1,15 +1,41 @@
 package k8s
 
 import (
+	"errors"
+	"flag"
 	"os"
 	"strings"
 
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
+const KubeContextEnv = "KUBE_CONTEXT"
+
+var (
+	// serviceAccountNamespaceFile holds the namespace of the pod in the cluster.
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	// kubeconfig is an explicit kubeconfig path, KUBECONFIG and ~/.kube/config are used otherwise.
+	kubeconfig string
+	// kubeContext overrides the current context of the kubeconfig.
+	kubeContext = os.Getenv(KubeContextEnv)
+	// namespace overrides the namespace of the pod or of the kubeconfig context.
+	namespace string
+)
+
+// RegisterFlags registers the flags used to access the cluster from outside of it.
+func RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&kubeconfig, "kubeconfig", kubeconfig, "path to the kubeconfig file used outside of the cluster, defaults to KUBECONFIG or ~/.kube/config")
+	fs.StringVar(&kubeContext, "kube-context", kubeContext, "kubeconfig context used outside of the cluster, defaults to the current context or "+KubeContextEnv)
+	fs.StringVar(&namespace, "namespace", namespace, "namespace of the secrets, defaults to the pod or the kubeconfig context namespace")
+}
+
+// Client returns a client for the in-cluster config, falling back to
+// the kubeconfig when the agent runs outside of the cluster.
 func Client() (*kubernetes.Clientset, error) {
-	config, err := rest.InClusterConfig()
+	config, err := restConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -17,15 +43,57 @@ func Client() (*kubernetes.Clientset, error) {
 	return kubernetes.NewForConfig(config)
 }
 
+func restConfig() (*rest.Config, error) {
+	if kubeconfig == "" && kubeContext == "" {
+		config, err := rest.InClusterConfig()
+		if err == nil {
+			return config, nil
+		}
+		if !errors.Is(err, rest.ErrNotInCluster) {
+			return nil, err
+		}
+	}
+
+	return clientConfig().ClientConfig()
+}
+
+func clientConfig() clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: kubeContext,
+		Context:        clientcmdapi.Context{Namespace: namespace},
+	}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+}
+
+// ErrUnknownNamespace is returned if the namespace is neither set nor found in the cluster or the kubeconfig.
+var ErrUnknownNamespace = errors.New("could not determine the namespace, set -namespace or POD_NAMESPACE")
+
+// Namespace returns the namespace set by the flag or POD_NAMESPACE, falling back to the namespace
+// of the service account in the cluster and of the kubeconfig context outside of it.
 func Namespace() (string, error) {
+	if namespace != "" {
+		return namespace, nil
+	}
 	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
 		return ns, nil
 	}
-	if data, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace"); err == nil {
+	if data, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
 		if ns := strings.TrimSpace(string(data)); len(ns) > 0 {
 			return ns, nil
 		}
+		return "", ErrUnknownNamespace
+	}
+	ns, _, err := clientConfig().Namespace()
+	if clientcmd.IsEmptyConfig(err) {
+		return "", ErrUnknownNamespace
+	}
+	if err != nil {
 		return "", err
 	}
-	return "", nil
+	if ns == "" {
+		return "", ErrUnknownNamespace
+	}
+	return ns, nil
 }
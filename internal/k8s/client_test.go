@@ -0,0 +1,165 @@
+package k8s
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+- name: prod
+  cluster:
+    server: https://prod.example.com
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: user
+    namespace: dev-ns
+- name: prod
+  context:
+    cluster: prod
+    user: user
+users:
+- name: user
+  user:
+    token: token
+`
+
+func setupKubeconfig(t *testing.T, path, context, ns string) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("POD_NAMESPACE", "")
+	if _, err := os.Stat(serviceAccountNamespaceFile); err == nil {
+		t.Skip("running inside of a cluster")
+	}
+
+	oldKubeconfig, oldContext, oldNamespace := kubeconfig, kubeContext, namespace
+	t.Cleanup(func() {
+		kubeconfig, kubeContext, namespace = oldKubeconfig, oldContext, oldNamespace
+	})
+	kubeconfig, kubeContext, namespace = path, context, ns
+}
+
+func TestKubeconfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(path, []byte(testKubeconfig), 0600))
+
+	tests := []struct {
+		name      string
+		env       string
+		flag      string
+		context   string
+		namespace string
+		wantHost  string
+		wantNs    string
+	}{
+		{
+			name:     "KUBECONFIG",
+			env:      path,
+			wantHost: "https://dev.example.com",
+			wantNs:   "dev-ns",
+		},
+		{
+			name:     "flag",
+			flag:     path,
+			wantHost: "https://dev.example.com",
+			wantNs:   "dev-ns",
+		},
+		{
+			name:     "context override",
+			env:      path,
+			context:  "prod",
+			wantHost: "https://prod.example.com",
+			wantNs:   "default",
+		},
+		{
+			name:      "namespace override",
+			env:       path,
+			namespace: "other-ns",
+			wantHost:  "https://dev.example.com",
+			wantNs:    "other-ns",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("KUBECONFIG", tt.env)
+			setupKubeconfig(t, tt.flag, tt.context, tt.namespace)
+
+			config, err := restConfig()
+			require.NoError(t, err)
+			require.Equal(t, tt.wantHost, config.Host)
+			require.Equal(t, "token", config.BearerToken)
+
+			ns, err := Namespace()
+			require.NoError(t, err)
+			require.Equal(t, tt.wantNs, ns)
+		})
+	}
+}
+
+func TestKubeconfig_Missing(t *testing.T) {
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("HOME", t.TempDir())
+	setupKubeconfig(t, "", "", "")
+
+	_, err := Client()
+	require.Error(t, err)
+
+	_, err = Namespace()
+	require.ErrorIs(t, err, ErrUnknownNamespace)
+}
+
+func TestNamespace_ServiceAccount(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantNs  string
+		wantErr error
+	}{
+		{
+			name:    "namespace",
+			content: "pod-ns\n",
+			wantNs:  "pod-ns",
+		},
+		{
+			name:    "empty",
+			content: " \n",
+			wantErr: ErrUnknownNamespace,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set up
+			setupKubeconfig(t, "", "", "")
+			file := filepath.Join(t.TempDir(), "namespace")
+			require.NoError(t, os.WriteFile(file, []byte(tt.content), 0600))
+			old := serviceAccountNamespaceFile
+			t.Cleanup(func() { serviceAccountNamespaceFile = old })
+			serviceAccountNamespaceFile = file
+
+			// Run test
+			ns, err := Namespace()
+			require.ErrorIs(t, err, tt.wantErr)
+			require.Equal(t, tt.wantNs, ns)
+		})
+	}
+}
+
+func TestKubeconfig_UnknownContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(path, []byte(testKubeconfig), 0600))
+	setupKubeconfig(t, path, "staging", "")
+
+	_, err := Client()
+	require.ErrorContains(t, err, "staging")
+}
@@ -0,0 +1,188 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/hazelcast/platform-operator-agent/internal/logger"
+)
+
+const (
+	PodNameEnv       = "POD_NAME"
+	HazelcastNameEnv = "HAZELCAST_NAME"
+
+	eventComponent = "hazelcast-platform-operator-agent"
+	eventTimeout   = 5 * time.Second
+)
+
+// Reasons of the events published by the agent.
+const (
+	ReasonUploadStarted          = "BackupUploadStarted"
+	ReasonUploadSucceeded        = "BackupUploadSucceeded"
+	ReasonUploadFailed           = "BackupUploadFailed"
+	ReasonRestoreSkipped         = "RestoreSkipped"
+	ReasonRestoreCompleted       = "RestoreCompleted"
+	ReasonRestoreFailed          = "RestoreFailed"
+	ReasonUserCodeDownloadFailed = "UserCodeDownloadFailed"
+)
+
+var eventsLog = logger.New().Named("events")
+
+// EventRecorder publishes Kubernetes Events for the agent Pod and, if set, for the Hazelcast CR.
+// Publishing is best-effort, failures are only logged. A nil recorder discards all events.
+type EventRecorder struct {
+	client    kubernetes.Interface
+	namespace string
+	pod       string
+	podUID    types.UID
+	podOwners []metav1.OwnerReference
+	// hazelcast is the Hazelcast CR, events without its UID are not listed for the CR
+	hazelcast *corev1.ObjectReference
+}
+
+// NewEventRecorder returns a recorder for the Pod named by POD_NAME, or by the hostname inside of the cluster.
+// It returns nil if the Pod is unknown or the cluster cannot be reached.
+func NewEventRecorder() *EventRecorder {
+	pod := PodName()
+	if pod == "" {
+		return nil
+	}
+
+	c, err := Client()
+	if err != nil {
+		eventsLog.Warn("events are disabled, cannot create the client: " + err.Error())
+		return nil
+	}
+	ns, err := Namespace()
+	if err != nil {
+		eventsLog.Warn("events are disabled, cannot find the namespace", zap.Error(err))
+		return nil
+	}
+
+	return NewEventRecorderForClient(c, ns, pod).ForHazelcast(os.Getenv(HazelcastNameEnv))
+}
+
+// NewEventRecorderForClient returns a recorder publishing the events of the given Pod using the client.
+func NewEventRecorderForClient(client kubernetes.Interface, namespace, pod string) *EventRecorder {
+	r := &EventRecorder{
+		client:    client,
+		namespace: namespace,
+		pod:       pod,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+	if p, err := client.CoreV1().Pods(namespace).Get(ctx, pod, metav1.GetOptions{}); err == nil {
+		r.podUID = p.UID
+		r.podOwners = p.OwnerReferences
+	}
+	return r
+}
+
+// ForHazelcast returns a copy of the recorder that also publishes the events for the Hazelcast CR. The CR is
+// resolved from the owner of the StatefulSet of the Pod, if it cannot be resolved the events are published
+// for the Pod only.
+func (r *EventRecorder) ForHazelcast(name string) *EventRecorder {
+	if r == nil || name == "" {
+		return r
+	}
+	c := *r
+	ref, err := r.hazelcastRef(name)
+	if err != nil {
+		eventsLog.Info("events are published for the Pod only, cannot resolve the Hazelcast CR: "+err.Error(), zap.String("name", name))
+		c.hazelcast = nil
+		return &c
+	}
+	c.hazelcast = ref
+	return &c
+}
+
+func (r *EventRecorder) hazelcastRef(name string) (*corev1.ObjectReference, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+
+	for _, owner := range r.podOwners {
+		if owner.Kind != "StatefulSet" {
+			continue
+		}
+		sts, err := r.client.AppsV1().StatefulSets(r.namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range sts.OwnerReferences {
+			if o.Kind == "Hazelcast" && o.Name == name {
+				return &corev1.ObjectReference{
+					APIVersion: o.APIVersion,
+					Kind:       o.Kind,
+					Namespace:  r.namespace,
+					Name:       o.Name,
+					UID:        o.UID,
+				}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("the StatefulSet of pod %s is not owned by Hazelcast %s", r.pod, name)
+}
+
+// Normal publishes an informational event.
+func (r *EventRecorder) Normal(ctx context.Context, reason, message string) {
+	r.event(ctx, corev1.EventTypeNormal, reason, message)
+}
+
+// Warning publishes a warning event.
+func (r *EventRecorder) Warning(ctx context.Context, reason, message string) {
+	r.event(ctx, corev1.EventTypeWarning, reason, message)
+}
+
+func (r *EventRecorder) event(ctx context.Context, eventType, reason, message string) {
+	if r == nil || r.client == nil {
+		return
+	}
+
+	// events are published even if the operation has been canceled
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), eventTimeout)
+	defer cancel()
+
+	objects := []corev1.ObjectReference{{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  r.namespace,
+		Name:       r.pod,
+		UID:        r.podUID,
+	}}
+	if r.hazelcast != nil {
+		objects = append(objects, *r.hazelcast)
+	}
+
+	now := metav1.Now()
+	for _, obj := range objects {
+		e := &corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s.%x", obj.Name, now.UnixNano()),
+				Namespace: r.namespace,
+			},
+			InvolvedObject:      obj,
+			Reason:              reason,
+			Message:             message,
+			Type:                eventType,
+			Source:              corev1.EventSource{Component: eventComponent},
+			FirstTimestamp:      now,
+			LastTimestamp:       now,
+			Count:               1,
+			ReportingController: eventComponent,
+			ReportingInstance:   r.pod,
+		}
+		if _, err := r.client.CoreV1().Events(r.namespace).Create(ctx, e, metav1.CreateOptions{}); err != nil {
+			eventsLog.Warn("could not publish the event: "+err.Error(),
+				zap.String("reason", reason), zap.String("kind", obj.Kind), zap.String("name", obj.Name))
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func listEvents(t *testing.T, c *fake.Clientset) []corev1.Event {
+	events, err := c.CoreV1().Events("ns").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	return events.Items
+}
+
+func TestEventRecorder(t *testing.T) {
+	c := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "hz-0", Namespace: "ns", UID: "pod-uid"},
+	})
+	r := NewEventRecorderForClient(c, "ns", "hz-0")
+
+	r.Normal(context.Background(), ReasonRestoreCompleted, "Restored member 0")
+	events := listEvents(t, c)
+	require.Len(t, events, 1)
+	require.Equal(t, corev1.EventTypeNormal, events[0].Type)
+	require.Equal(t, ReasonRestoreCompleted, events[0].Reason)
+	require.Equal(t, "Restored member 0", events[0].Message)
+	require.Equal(t, corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  "ns",
+		Name:       "hz-0",
+		UID:        "pod-uid",
+	}, events[0].InvolvedObject)
+}
+
+func TestEventRecorder_ForHazelcast(t *testing.T) {
+	c := fake.NewSimpleClientset(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: "hz-0", Namespace: "ns", UID: "pod-uid",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "hz"}},
+		}},
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+			Name: "hz", Namespace: "ns",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "hazelcast.com/v1alpha1", Kind: "Hazelcast", Name: "hz", UID: "hz-uid"}},
+		}},
+	)
+	r := NewEventRecorderForClient(c, "ns", "hz-0")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.ForHazelcast("hz").Warning(ctx, ReasonUploadFailed, "Failed to upload")
+
+	events := listEvents(t, c)
+	require.Len(t, events, 2)
+	objects := map[string]corev1.ObjectReference{}
+	for _, e := range events {
+		require.Equal(t, corev1.EventTypeWarning, e.Type)
+		require.Equal(t, ReasonUploadFailed, e.Reason)
+		objects[e.InvolvedObject.Kind] = e.InvolvedObject
+	}
+	require.Equal(t, corev1.ObjectReference{
+		APIVersion: "hazelcast.com/v1alpha1",
+		Kind:       "Hazelcast",
+		Namespace:  "ns",
+		Name:       "hz",
+		UID:        "hz-uid",
+	}, objects["Hazelcast"])
+	require.Equal(t, "hz-0", objects["Pod"].Name)
+
+	// the original recorder publishes for the Pod only
+	r.Normal(context.Background(), ReasonUploadStarted, "Started")
+	require.Len(t, listEvents(t, c), 3)
+
+	// an unknown CR is not referenced without its UID
+	r.ForHazelcast("other").Normal(context.Background(), ReasonUploadStarted, "Started")
+	require.Len(t, listEvents(t, c), 4)
+}
+
+func TestEventRecorder_BestEffort(t *testing.T) {
+	c := fake.NewSimpleClientset()
+	c.PrependReactor("create", "events", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("forbidden")
+	})
+	r := NewEventRecorderForClient(c, "ns", "hz-0")
+	require.NotPanics(t, func() {
+		r.Warning(context.Background(), ReasonUploadFailed, "Failed to upload")
+	})
+
+	var nilRecorder *EventRecorder
+	require.NotPanics(t, func() {
+		nilRecorder.ForHazelcast("hz").Normal(context.Background(), ReasonRestoreSkipped, "Skipped")
+	})
+}
+
+func TestNewEventRecorder_UnknownPod(t *testing.T) {
+	t.Setenv(PodNameEnv, "")
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	require.Nil(t, NewEventRecorder())
+}
@@ -0,0 +1,108 @@
+package k8s
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// PodIndexLabel is set by the StatefulSet controller to the ordinal of the Pod
+	PodIndexLabel = "apps.kubernetes.io/pod-index"
+	// PodIndexEnv is the environment variable with the pod-index label, exposed by the downward API
+	PodIndexEnv = "POD_INDEX"
+	// podLookupTimeout limits reading the Pod from the API
+	podLookupTimeout = 10 * time.Second
+)
+
+// podLabelsFile is the downward API volume file with the labels of the Pod
+var podLabelsFile = "/etc/podinfo/labels"
+
+// ErrUnknownPod is returned when the agent does not know its Pod
+var ErrUnknownPod = errors.New("pod name is unknown")
+
+// PodName returns the name of the agent Pod from POD_NAME, or the hostname inside of the cluster. It is empty if unknown.
+func PodName() string {
+	pod := os.Getenv(PodNameEnv)
+	if pod == "" && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		pod, _ = os.Hostname()
+	}
+	return pod
+}
+
+// PodLabel returns the label of the agent Pod from the downward API labels file or, if it is not mounted, from the API.
+// The returned source describes where the label was found.
+func PodLabel(ctx context.Context, key string) (value, source string, err error) {
+	labels, err := readLabelsFile(podLabelsFile)
+	if err == nil {
+		v, ok := labels[key]
+		if !ok {
+			return "", "", fmt.Errorf("label %s is not in %s", key, podLabelsFile)
+		}
+		return v, "downward API file " + podLabelsFile, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", "", err
+	}
+
+	pod := PodName()
+	if pod == "" {
+		return "", "", ErrUnknownPod
+	}
+	c, err := Client()
+	if err != nil {
+		return "", "", err
+	}
+	ns, err := Namespace()
+	if err != nil {
+		return "", "", err
+	}
+	v, err := PodLabelForClient(ctx, c, ns, pod, key)
+	return v, "Kubernetes API", err
+}
+
+// PodLabelForClient returns the label of the Pod using the client.
+func PodLabelForClient(ctx context.Context, client kubernetes.Interface, namespace, pod, key string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, podLookupTimeout)
+	defer cancel()
+	p, err := client.CoreV1().Pods(namespace).Get(ctx, pod, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	v, ok := p.Labels[key]
+	if !ok {
+		return "", fmt.Errorf("pod %s has no label %s", pod, key)
+	}
+	return v, nil
+}
+
+// readLabelsFile parses the downward API labels file, with a key="value" line for each label
+func readLabelsFile(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	labels := map[string]string{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		k, v, ok := strings.Cut(s.Text(), "=")
+		if !ok {
+			continue
+		}
+		if uv, err := strconv.Unquote(v); err == nil {
+			v = uv
+		}
+		labels[k] = v
+	}
+	return labels, s.Err()
+}
@@ -0,0 +1,53 @@
+package k8s
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPodLabel_DownwardAPIFile(t *testing.T) {
+	defer func(f string) { podLabelsFile = f }(podLabelsFile)
+	podLabelsFile = path.Join(t.TempDir(), "labels")
+	require.Nil(t, os.WriteFile(podLabelsFile, []byte("app.kubernetes.io/name=\"hazelcast\"\n"+PodIndexLabel+"=\"2\"\n"), 0600))
+
+	v, source, err := PodLabel(context.Background(), PodIndexLabel)
+	require.Nil(t, err)
+	require.Equal(t, "2", v)
+	require.Equal(t, "downward API file "+podLabelsFile, source)
+
+	_, _, err = PodLabel(context.Background(), "missing")
+	require.EqualError(t, err, "label missing is not in "+podLabelsFile)
+}
+
+func TestPodLabel_UnknownPod(t *testing.T) {
+	defer func(f string) { podLabelsFile = f }(podLabelsFile)
+	podLabelsFile = path.Join(t.TempDir(), "labels")
+	t.Setenv(PodNameEnv, "")
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+
+	_, _, err := PodLabel(context.Background(), PodIndexLabel)
+	require.ErrorIs(t, err, ErrUnknownPod)
+}
+
+func TestPodLabelForClient(t *testing.T) {
+	c := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "hz-0", Namespace: "ns", Labels: map[string]string{PodIndexLabel: "0"}},
+	})
+
+	v, err := PodLabelForClient(context.Background(), c, "ns", "hz-0", PodIndexLabel)
+	require.Nil(t, err)
+	require.Equal(t, "0", v)
+
+	_, err = PodLabelForClient(context.Background(), c, "ns", "hz-0", "missing")
+	require.EqualError(t, err, "pod hz-0 has no label missing")
+
+	_, err = PodLabelForClient(context.Background(), c, "ns", "hz-1", PodIndexLabel)
+	require.Error(t, err)
+}
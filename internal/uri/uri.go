@@ -70,3 +70,15 @@ func Join(commonURI, path string) (string, error) {
 	}
 	return u.String(), nil
 }
+
+// Redact removes the query, which holds the signature of pre-signed URLs, and the user info of the URL
+func Redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "invalid URL"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
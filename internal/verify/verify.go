@@ -0,0 +1,277 @@
+// Package verify checks the SHA-256 digests and the detached signatures of downloaded files
+// before they are placed in the destination.
+package verify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ChecksumSuffix is the suffix of the companion checksum files
+	ChecksumSuffix = ".sha256"
+	// SignatureSuffix is the suffix of the detached signature files
+	SignatureSuffix = ".sig"
+	// PublicKeySecretKey is the key of the PEM encoded public key in the signature secret
+	PublicKeySecretKey = "public-key"
+)
+
+// Options configure the verification of the downloaded files, it is disabled if all options are empty.
+type Options struct {
+	// SHA256 are the expected digests in hex, each file must match one of them
+	SHA256 []string
+	// Manifest is the location of a checksum manifest in sha256sum format at the download source
+	Manifest string
+	// ChecksumFiles requires a companion <file>.sha256 at the download source for each file
+	ChecksumFiles bool
+	// PublicKey verifies the detached <file>.sig signature at the download source for each file, if set
+	PublicKey crypto.PublicKey
+}
+
+func (o Options) Enabled() bool {
+	return len(o.SHA256) > 0 || o.Manifest != "" || o.ChecksumFiles || o.PublicKey != nil
+}
+
+// Fetch reads the file at the location of the download source with the suffix appended, e.g. a companion checksum file
+type Fetch func(ctx context.Context, location, suffix string) ([]byte, error)
+
+// Verifier verifies the downloaded files. A nil verifier accepts all files.
+type Verifier struct {
+	opts     Options
+	fetch    Fetch
+	digests  map[string]bool
+	manifest map[string]string
+}
+
+// New returns a verifier reading the manifest, the companion checksum files and the signatures with fetch.
+// It returns nil if the verification is disabled.
+func New(ctx context.Context, opts Options, fetch Fetch) (*Verifier, error) {
+	if !opts.Enabled() {
+		return nil, nil
+	}
+
+	v := &Verifier{opts: opts, fetch: fetch, digests: map[string]bool{}}
+	for _, d := range opts.SHA256 {
+		sum, err := parseDigest(d)
+		if err != nil {
+			return nil, err
+		}
+		v.digests[sum] = true
+	}
+	if opts.Manifest != "" {
+		data, err := fetch(ctx, opts.Manifest, "")
+		if err != nil {
+			return nil, fmt.Errorf("could not read the checksum manifest: %w", err)
+		}
+		if v.manifest, err = parseManifest(data); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// IsAuxiliary reports whether the file at the location is a checksum manifest, checksum or signature file of the verifier
+func (v *Verifier) IsAuxiliary(location string) bool {
+	if v == nil {
+		return false
+	}
+	return location == v.opts.Manifest ||
+		(v.opts.ChecksumFiles && strings.HasSuffix(location, ChecksumSuffix)) ||
+		(v.opts.PublicKey != nil && strings.HasSuffix(location, SignatureSuffix))
+}
+
+// SaveFile writes r into a temporary file next to dst, verifies it and renames it to dst. The location of the file
+// at the download source is used to fetch its companion files, and name to find its digest in the manifest.
+func SaveFile(ctx context.Context, v *Verifier, location, name string, r io.Reader, dst string) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tmp.Close()
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	h := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(tmp, h), r); err != nil {
+		return err
+	}
+	// flush file
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = v.verify(ctx, location, name, h.Sum(nil), tmp.Name()); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (v *Verifier) verify(ctx context.Context, location, name string, sum []byte, file string) error {
+	if v == nil {
+		return nil
+	}
+	digest := hex.EncodeToString(sum)
+
+	if len(v.digests) > 0 && !v.digests[digest] {
+		return fmt.Errorf("SHA-256 digest %s of %s is not one of the expected digests", digest, name)
+	}
+	if v.manifest != nil {
+		want, ok := v.manifest[name]
+		if !ok {
+			return fmt.Errorf("%s is not in the checksum manifest", name)
+		}
+		if want != digest {
+			return fmt.Errorf("SHA-256 digest of %s is %s, the checksum manifest expects %s", name, digest, want)
+		}
+	}
+	if v.opts.ChecksumFiles {
+		data, err := v.fetch(ctx, location, ChecksumSuffix)
+		if err != nil {
+			return fmt.Errorf("could not read the checksum file of %s: %w", name, err)
+		}
+		want, err := ParseChecksumFile(data)
+		if err != nil {
+			return fmt.Errorf("invalid checksum file of %s: %w", name, err)
+		}
+		if want != digest {
+			return fmt.Errorf("SHA-256 digest of %s is %s, the checksum file expects %s", name, digest, want)
+		}
+	}
+	if v.opts.PublicKey != nil {
+		sig, err := v.fetch(ctx, location, SignatureSuffix)
+		if err != nil {
+			return fmt.Errorf("could not read the signature of %s: %w", name, err)
+		}
+		if err = verifySignature(v.opts.PublicKey, sum, file, decodeSignature(sig)); err != nil {
+			return fmt.Errorf("invalid signature of %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+var errInvalidSignature = errors.New("signature verification failed")
+
+// verifySignature verifies the signature of the SHA-256 digest, or of the file content for Ed25519 keys
+func verifySignature(key crypto.PublicKey, sum []byte, file string, sig []byte) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, sum, sig) == nil || rsa.VerifyPSS(k, crypto.SHA256, sum, sig, nil) == nil {
+			return nil
+		}
+		return errInvalidSignature
+	case *ecdsa.PublicKey:
+		if ecdsa.VerifyASN1(k, sum, sig) {
+			return nil
+		}
+		return errInvalidSignature
+	case ed25519.PublicKey:
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if ed25519.Verify(k, data, sig) {
+			return nil
+		}
+		return errInvalidSignature
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+}
+
+// decodeSignature accepts raw and base64 encoded signatures
+func decodeSignature(sig []byte) []byte {
+	if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig))); err == nil {
+		return decoded
+	}
+	return sig
+}
+
+// ParsePublicKey parses a PEM encoded PKIX or PKCS #1 public key
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid public key: no PEM data")
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return key, nil
+}
+
+// PublicKeyFromSecret parses the public key of the signature secret
+func PublicKeyFromSecret(secret map[string][]byte) (crypto.PublicKey, error) {
+	data, ok := secret[PublicKeySecretKey]
+	if !ok {
+		return nil, fmt.Errorf("invalid secret: missing key: %v", PublicKeySecretKey)
+	}
+	return ParsePublicKey(data)
+}
+
+// ParseChecksumFile returns the hex SHA-256 digest of a companion checksum file, in sha256sum format or the digest only
+func ParseChecksumFile(data []byte) (string, error) {
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", errors.New("checksum file is empty")
+	}
+	return parseDigest(fields[0])
+}
+
+func parseDigest(s string) (string, error) {
+	s = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "sha256:"))
+	if b, err := hex.DecodeString(s); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 digest %q", s)
+	}
+	return s, nil
+}
+
+// parseManifest parses the "<digest>  <name>" lines of a sha256sum manifest
+func parseManifest(data []byte) (map[string]string, error) {
+	manifest := map[string]string{}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		d, name, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid checksum manifest line %q", line)
+		}
+		digest, err := parseDigest(d)
+		if err != nil {
+			return nil, err
+		}
+		// binary mode files are marked with *
+		name = strings.TrimPrefix(strings.TrimSpace(name), "*")
+		manifest[strings.TrimPrefix(name, "./")] = digest
+	}
+	return manifest, s.Err()
+}
@@ -0,0 +1,176 @@
+package verify
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var content = []byte("jar content")
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// fetchFiles serves the files by their location and suffix
+func fetchFiles(files map[string][]byte) Fetch {
+	return func(_ context.Context, location, suffix string) ([]byte, error) {
+		data, ok := files[location+suffix]
+		if !ok {
+			return nil, fmt.Errorf("%s not found", location+suffix)
+		}
+		return data, nil
+	}
+}
+
+func TestSaveFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		files   map[string][]byte
+		wantErr string
+	}{
+		{
+			name: "no verification",
+		},
+		{
+			name: "expected digest",
+			opts: Options{SHA256: []string{strings.Repeat("0", 64), "sha256:" + digest(content)}},
+		},
+		{
+			name:    "unexpected digest",
+			opts:    Options{SHA256: []string{strings.Repeat("0", 64)}},
+			wantErr: "SHA-256 digest " + digest(content) + " of lib/app.jar is not one of the expected digests",
+		},
+		{
+			name:  "manifest",
+			opts:  Options{Manifest: "SHA256SUMS"},
+			files: map[string][]byte{"SHA256SUMS": []byte("# checksums\n" + digest(content) + " *./lib/app.jar\n" + strings.Repeat("0", 64) + "  other.jar\n")},
+		},
+		{
+			name:    "not in the manifest",
+			opts:    Options{Manifest: "SHA256SUMS"},
+			files:   map[string][]byte{"SHA256SUMS": []byte(strings.Repeat("0", 64) + "  other.jar\n")},
+			wantErr: "lib/app.jar is not in the checksum manifest",
+		},
+		{
+			name:  "checksum file",
+			opts:  Options{ChecksumFiles: true},
+			files: map[string][]byte{"src/lib/app.jar.sha256": []byte(digest(content) + "  app.jar\n")},
+		},
+		{
+			name:    "checksum file mismatch",
+			opts:    Options{ChecksumFiles: true},
+			files:   map[string][]byte{"src/lib/app.jar.sha256": []byte(strings.Repeat("0", 64))},
+			wantErr: "SHA-256 digest of lib/app.jar is " + digest(content) + ", the checksum file expects " + strings.Repeat("0", 64),
+		},
+		{
+			name:    "missing checksum file",
+			opts:    Options{ChecksumFiles: true},
+			wantErr: "could not read the checksum file of lib/app.jar: src/lib/app.jar.sha256 not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set up
+			v, err := New(context.Background(), tt.opts, fetchFiles(tt.files))
+			require.Nil(t, err)
+			dir := t.TempDir()
+			dst := path.Join(dir, "app.jar")
+
+			// Run test
+			err = SaveFile(context.Background(), v, "src/lib/app.jar", "lib/app.jar", strings.NewReader(string(content)), dst)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				// nothing is placed in the destination
+				entries, err := os.ReadDir(dir)
+				require.Nil(t, err)
+				require.Empty(t, entries)
+				return
+			}
+			require.Nil(t, err)
+			got, err := os.ReadFile(dst)
+			require.Nil(t, err)
+			require.Equal(t, content, got)
+		})
+	}
+}
+
+func TestSaveFile_Signature(t *testing.T) {
+	sum := sha256.Sum256(content)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	rsaSig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sum[:])
+	require.Nil(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	ecSig, err := ecdsa.SignASN1(rand.Reader, ecKey, sum[:])
+	require.Nil(t, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	edSig := ed25519.Sign(edKey, content)
+
+	tests := []struct {
+		name    string
+		key     crypto.PublicKey
+		sig     []byte
+		wantErr string
+	}{
+		{name: "RSA", key: &rsaKey.PublicKey, sig: rsaSig},
+		{name: "ECDSA base64", key: &ecKey.PublicKey, sig: []byte(base64.StdEncoding.EncodeToString(ecSig) + "\n")},
+		{name: "Ed25519", key: edPub, sig: edSig},
+		{name: "wrong key", key: &rsaKey.PublicKey, sig: edSig, wantErr: "invalid signature of app.jar: signature verification failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set up
+			der, err := x509.MarshalPKIXPublicKey(tt.key)
+			require.Nil(t, err)
+			key, err := PublicKeyFromSecret(map[string][]byte{
+				PublicKeySecretKey: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+			})
+			require.Nil(t, err)
+			v, err := New(context.Background(), Options{PublicKey: key}, fetchFiles(map[string][]byte{"app.jar.sig": tt.sig}))
+			require.Nil(t, err)
+			dst := path.Join(t.TempDir(), "app.jar")
+
+			// Run test
+			err = SaveFile(context.Background(), v, "app.jar", "app.jar", strings.NewReader(string(content)), dst)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				require.NoFileExists(t, dst)
+				return
+			}
+			require.Nil(t, err)
+			require.FileExists(t, dst)
+		})
+	}
+}
+
+func TestNew_InvalidOptions(t *testing.T) {
+	_, err := New(context.Background(), Options{SHA256: []string{"abc"}}, nil)
+	require.EqualError(t, err, `invalid SHA-256 digest "abc"`)
+
+	_, err = New(context.Background(), Options{Manifest: "SHA256SUMS"}, fetchFiles(nil))
+	require.EqualError(t, err, "could not read the checksum manifest: SHA256SUMS not found")
+
+	_, err = PublicKeyFromSecret(map[string][]byte{})
+	require.EqualError(t, err, "invalid secret: missing key: public-key")
+}
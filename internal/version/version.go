@@ -0,0 +1,6 @@
+// Package version holds the version of the agent, set at build time with
+// -ldflags "-X github.com/hazelcast/platform-operator-agent/internal/version.Version=<version>".
+package version
+
+// Version is the agent version
+var Version = "dev"
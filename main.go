@@ -11,6 +11,7 @@ import (
 	downloadurl "github.com/hazelcast/platform-operator-agent/init/file_download_url"
 	downloadbucket "github.com/hazelcast/platform-operator-agent/init/jar_download_bucket"
 	"github.com/hazelcast/platform-operator-agent/init/restore"
+	"github.com/hazelcast/platform-operator-agent/internal/k8s"
 	"github.com/hazelcast/platform-operator-agent/sidecar"
 )
 
@@ -24,8 +25,11 @@ func main() {
 	subcommands.Register(&downloadbucket.Cmd{}, "")
 	subcommands.Register(&restore.LocalInPVCCmd{}, "")
 	subcommands.Register(&restore.BucketToPVCCmd{}, "")
+	subcommands.Register(&restore.URLToPVCCmd{}, "")
+	subcommands.Register(&restore.StatusCmd{}, "")
 	subcommands.Register(&sidecar.Cmd{}, "")
 
+	k8s.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
 	ctx := context.Background()
@@ -2,12 +2,14 @@ package sidecar
 
 import (
 	"context"
+	"fmt"
 	"path"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 
 	"github.com/hazelcast/platform-operator-agent/internal/bucket"
+	"github.com/hazelcast/platform-operator-agent/internal/k8s"
 	"github.com/hazelcast/platform-operator-agent/internal/logger"
 	"github.com/hazelcast/platform-operator-agent/internal/uri"
 )
@@ -23,6 +25,7 @@ type task struct {
 	bucketURI string
 	key       string
 	err       error
+	events    *k8s.EventRecorder
 }
 
 func (t *task) process(ID uuid.UUID) {
@@ -31,6 +34,15 @@ func (t *task) process(ID uuid.UUID) {
 	defer backupLog.Info("task is finished", zap.Uint32("task id", ID.ID()))
 	defer t.cancel()
 
+	t.events.Normal(t.ctx, k8s.ReasonUploadStarted, fmt.Sprintf("Started uploading the backup of member %d to %s", t.req.MemberID, t.req.BucketURL))
+	defer func() {
+		if t.err != nil {
+			t.events.Warning(t.ctx, k8s.ReasonUploadFailed, fmt.Sprintf("Failed to upload the backup of member %d: %v", t.req.MemberID, t.err))
+			return
+		}
+		t.events.Normal(t.ctx, k8s.ReasonUploadSucceeded, fmt.Sprintf("Uploaded the backup of member %d to %s", t.req.MemberID, t.backupKey))
+	}()
+
 	bucketURI, err := uri.NormalizeURI(t.req.BucketURL)
 	if err != nil {
 		backupLog.Error("error occurred while parsing bucket URI: "+err.Error(), zap.Uint32("task id", ID.ID()))
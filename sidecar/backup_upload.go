@@ -4,7 +4,10 @@ import (
 	"archive/tar"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"os"
@@ -19,6 +22,14 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/verify"
+)
+
+// Metadata keys of the uploaded backup archives, used on restore to map members to archives and to check the
+// hot-restart UUID of the extracted archive
+const (
+	MemberIDMetadataKey   = "member-id"
+	MemberUUIDMetadataKey = "member-uuid"
 )
 
 var (
@@ -54,6 +65,8 @@ func UploadBackup(ctx context.Context, bucket *blob.Bucket, backupsDir, prefix s
 		return "", ErrMemberIDOutOfIndex
 	}
 
+	metadata := map[string]string{MemberIDMetadataKey: strconv.Itoa(memberID)}
+
 	// If there is only one backup, members are isolated. No need for memberID
 	if len(backupUUIDS) == 1 {
 		memberID = 0
@@ -61,8 +74,9 @@ func UploadBackup(ctx context.Context, bucket *blob.Bucket, backupsDir, prefix s
 	uuid := backupUUIDS[memberID]
 	uuidDir := filepath.Join(latestSeqDir, uuid.Name())
 	key := filepath.Join(prefix, humanReadableSeq, uuid.Name()+".tar.gz")
+	metadata[MemberUUIDMetadataKey] = uuid.Name()
 
-	err = uploadBackup(ctx, bucket, key, uuidDir, uuid.Name())
+	err = uploadBackup(ctx, bucket, key, uuidDir, uuid.Name(), metadata)
 	if err != nil {
 		return "", err
 	}
@@ -90,18 +104,25 @@ func allFilesMarkedToBeDeleted(files []fs.DirEntry, dir string) bool {
 	return true
 }
 
-func uploadBackup(ctx context.Context, bucket *blob.Bucket, name, backupDir, baseDirName string) error {
-	w, err := bucket.NewWriter(ctx, name, nil)
+// uploadBackup uploads the archive of the backup and its companion checksum file, which the restore verifies
+// the downloaded archive with
+func uploadBackup(ctx context.Context, bucket *blob.Bucket, name, backupDir, baseDirName string, metadata map[string]string) error {
+	w, err := bucket.NewWriter(ctx, name, &blob.WriterOptions{Metadata: metadata})
 	if err != nil {
 		return err
 	}
 	defer w.Close()
 
-	if err := CreateArchive(w, backupDir, baseDirName); err != nil {
+	h := sha256.New()
+	if err := CreateArchive(io.MultiWriter(w, h), backupDir, baseDirName); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
 		return err
 	}
 
-	return w.Close()
+	checksum := fmt.Sprintf("%s  %s\n", hex.EncodeToString(h.Sum(nil)), filepath.Base(name))
+	return bucket.WriteAll(ctx, name+verify.ChecksumSuffix, []byte(checksum), nil)
 }
 
 func CreateArchive(w io.Writer, dir, baseDirName string) error {
@@ -116,7 +137,17 @@ func CreateArchive(w io.Writer, dir, baseDirName string) error {
 			return err
 		}
 
-		header, err := tar.FileInfoHeader(info, info.Name())
+		var link string
+		switch mode := info.Mode(); {
+		case mode&os.ModeSymlink != 0:
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case mode&(os.ModeDevice|os.ModeSocket|os.ModeIrregular) != 0:
+			return fmt.Errorf("unsupported file type %s: %s", mode.Type(), path)
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
 		if err != nil {
 			return err
 		}
@@ -128,7 +159,8 @@ func CreateArchive(w io.Writer, dir, baseDirName string) error {
 			return err
 		}
 
-		if info.IsDir() {
+		// only regular files have contents, opening a named pipe would block
+		if !info.Mode().IsRegular() {
 			return nil
 		}
 
@@ -3,8 +3,10 @@ package sidecar
 import (
 	"context"
 	"flag"
+	"time"
 
 	"github.com/google/subcommands"
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
 	"github.com/hazelcast/platform-operator-agent/internal/logger"
 	"github.com/kelseyhightower/envconfig"
 )
@@ -17,6 +19,11 @@ type Cmd struct {
 	CA           string `envconfig:"BACKUP_CA"`
 	Cert         string `envconfig:"BACKUP_CERT"`
 	Key          string `envconfig:"BACKUP_KEY"`
+	// Download options of the URL downloads
+	DownloadTimeout        time.Duration `envconfig:"BACKUP_DOWNLOAD_TIMEOUT"`
+	DownloadConnectTimeout time.Duration `envconfig:"BACKUP_DOWNLOAD_CONNECT_TIMEOUT"`
+	DownloadRetries        int           `envconfig:"BACKUP_DOWNLOAD_RETRIES"`
+	DownloadMaxSize        int64         `envconfig:"BACKUP_DOWNLOAD_MAX_SIZE"`
 }
 
 func (*Cmd) Name() string     { return "sidecar" }
@@ -29,6 +36,10 @@ func (p *Cmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&p.CA, "ca", "ca.crt", "http server client ca")
 	f.StringVar(&p.Cert, "cert", "tls.crt", "http server tls cert")
 	f.StringVar(&p.Key, "key", "tls.key", "http server tls key")
+	f.DurationVar(&p.DownloadTimeout, "download-timeout", fileutil.DefaultHTTPOptions.Timeout, "timeout of each URL download including the retries, unlimited if negative")
+	f.DurationVar(&p.DownloadConnectTimeout, "download-connect-timeout", fileutil.DefaultHTTPOptions.ConnectTimeout, "timeout of establishing a connection for URL downloads")
+	f.IntVar(&p.DownloadRetries, "download-retries", fileutil.DefaultHTTPOptions.Retries, "number of retries of URL downloads on network errors and 5xx responses, none if negative")
+	f.Int64Var(&p.DownloadMaxSize, "download-max-size", 0, "maximum size of each URL download in bytes, unlimited if 0")
 }
 
 func (p *Cmd) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -9,9 +9,9 @@ import (
 	"github.com/hazelcast/platform-operator-agent/internal/uri"
 )
 
-func downloadFile(ctx context.Context, req DownloadFileReq) error {
+func downloadFile(ctx context.Context, c *fileutil.HTTPClient, req DownloadFileReq) error {
 	if req.DownloadType == URLDownload {
-		return downloadFromUrl(ctx, req)
+		return downloadFromUrl(ctx, c, req)
 	}
 	return downloadFromBucket(ctx, req)
 }
@@ -28,6 +28,39 @@ func downloadFromBucket(ctx context.Context, req DownloadFileReq) error {
 	return nil
 }
 
-func downloadFromUrl(ctx context.Context, req DownloadFileReq) error {
-	return fileutil.DownloadFileFromURL(ctx, req.URL, req.DestDir)
+func downloadFromUrl(ctx context.Context, c *fileutil.HTTPClient, req DownloadFileReq) error {
+	if req.SecretName != "" {
+		secret, err := bucket.SecretData(ctx, req.SecretName)
+		if err != nil {
+			return fmt.Errorf("error occurred while reading the credentials: %w", err)
+		}
+		header, err := fileutil.HeaderFromSecret(secret)
+		if err != nil {
+			return err
+		}
+		c = c.WithHeader(header)
+	}
+
+	files := fileutil.TLSFiles{CA: req.CAFile, Cert: req.CertFile, Key: req.KeyFile}
+	var tlsData map[string][]byte
+	var err error
+	switch {
+	case req.TLSSecretName != "" && files.IsSet():
+		return fmt.Errorf("the TLS secret and the TLS files are mutually exclusive")
+	case req.TLSSecretName != "":
+		tlsData, err = bucket.SecretData(ctx, req.TLSSecretName)
+	case files.IsSet():
+		tlsData, err = files.Read()
+	}
+	if err != nil {
+		return fmt.Errorf("error occurred while reading the TLS config: %w", err)
+	}
+	if tlsData != nil {
+		cfg, err := fileutil.TLSConfigFromSecret(tlsData)
+		if err != nil {
+			return err
+		}
+		c = c.WithTLSConfig(cfg)
+	}
+	return fileutil.DownloadFileFromURL(ctx, c, req.URL, req.DestDir, nil)
 }
@@ -17,7 +17,9 @@ import (
 
 	"github.com/hazelcast/platform-operator-agent/internal/bucket"
 	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/k8s"
 	"github.com/hazelcast/platform-operator-agent/internal/logger"
+	"github.com/hazelcast/platform-operator-agent/internal/uri"
 )
 
 const (
@@ -28,8 +30,11 @@ var routerLog = logger.New().Named("router")
 
 // Service handles requests and keeps track of Tasks
 type Service struct {
-	Mu    sync.RWMutex
-	Tasks map[uuid.UUID]*task
+	Mu     sync.RWMutex
+	Tasks  map[uuid.UUID]*task
+	Events *k8s.EventRecorder
+	// HTTPClient downloads the URLs, the default options are used if nil
+	HTTPClient *fileutil.HTTPClient
 }
 
 // Req is a backup Service backup method request
@@ -125,6 +130,7 @@ func (s *Service) uploadHandler(w http.ResponseWriter, r *http.Request) {
 		req:    req,
 		ctx:    ctx,
 		cancel: cancel,
+		events: s.Events.ForHazelcast(req.HazelcastCRName),
 	}
 
 	s.Mu.Lock()
@@ -146,11 +152,17 @@ const (
 )
 
 type DownloadFileReq struct {
-	URL          string       `json:"url"`
-	FileName     string       `json:"file_name"`
-	DestDir      string       `json:"dest_dir"`
+	URL      string `json:"url"`
+	FileName string `json:"file_name"`
+	DestDir  string `json:"dest_dir"`
+	// SecretName is the secret with the bucket credentials, or the credentials of the URL
 	SecretName   string       `json:"secret_name"`
 	DownloadType DownloadType `json:"download_type"`
+	// TLSSecretName is the secret with the CA bundle and the client certificate of the URL, alternatively to the files
+	TLSSecretName string `json:"tls_secret_name,omitempty"`
+	CAFile        string `json:"ca_file,omitempty"`
+	CertFile      string `json:"cert_file,omitempty"`
+	KeyFile       string `json:"key_file,omitempty"`
 }
 
 func (s *Service) downloadFileHandler(w http.ResponseWriter, r *http.Request) {
@@ -162,16 +174,24 @@ func (s *Service) downloadFileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
-	err := downloadFile(ctx, req)
+	ctx := r.Context()
+	err := downloadFile(ctx, s.httpClient(), req)
 	if err != nil {
 		routerLog.Error(err.Error())
+		s.Events.Warning(ctx, k8s.ReasonUserCodeDownloadFailed, fmt.Sprintf("Failed to download %s: %v", uri.Redact(req.URL), err))
 		httpError(w, http.StatusBadRequest)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
 
+func (s *Service) httpClient() *fileutil.HTTPClient {
+	if s.HTTPClient == nil {
+		return fileutil.NewHTTPClient(fileutil.DefaultHTTPOptions)
+	}
+	return s.HTTPClient
+}
+
 func (s *Service) bundleHandler(w http.ResponseWriter, r *http.Request) {
 	var req bucket.BundleReq
 	if err := decodeBody(r, &req); err != nil {
@@ -183,6 +203,7 @@ func (s *Service) bundleHandler(w http.ResponseWriter, r *http.Request) {
 
 	if err := bucket.DownloadBundle(r.Context(), req); err != nil {
 		routerLog.Error(err.Error())
+		s.Events.Warning(r.Context(), k8s.ReasonUserCodeDownloadFailed, fmt.Sprintf("Failed to download the bundle from %s: %v", uri.Redact(req.URL), err))
 		httpError(w, http.StatusBadRequest)
 		return
 	}
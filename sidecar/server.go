@@ -12,6 +12,8 @@ import (
 	"github.com/gorilla/mux"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/k8s"
 	"github.com/hazelcast/platform-operator-agent/internal/logger"
 )
 
@@ -32,7 +34,14 @@ func startServer(ctx context.Context, s *Cmd) error {
 	}
 
 	backupService := Service{
-		Tasks: make(map[uuid.UUID]*task),
+		Tasks:  make(map[uuid.UUID]*task),
+		Events: k8s.NewEventRecorder(),
+		HTTPClient: fileutil.NewHTTPClient(fileutil.HTTPOptions{
+			ConnectTimeout: s.DownloadConnectTimeout,
+			Timeout:        s.DownloadTimeout,
+			Retries:        s.DownloadRetries,
+			MaxSize:        s.DownloadMaxSize,
+		}),
 	}
 
 	dialService := DialService{}
@@ -2,6 +2,8 @@ package sidecar
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,15 +12,22 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/hazelcast/platform-operator-agent/internal/fileutil"
+	"github.com/hazelcast/platform-operator-agent/internal/k8s"
+	"github.com/hazelcast/platform-operator-agent/internal/verify"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gocloud.dev/blob/fileblob"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 var exampleTarGzFiles = []fileutil.File{
@@ -499,6 +508,14 @@ func TestUploadBackup(t *testing.T) {
 			}
 			require.Equal(t, path.Join(prefix, tt.wantBucket), backupKey)
 
+			// check if the archive records the uploading member
+			attrs, err := bucket.Attributes(ctx, backupKey)
+			require.Nil(t, err)
+			require.Equal(t, map[string]string{
+				MemberIDMetadataKey:   strconv.Itoa(tt.memberID),
+				MemberUUIDMetadataKey: path.Base(tt.want),
+			}, attrs.Metadata)
+
 			// check if backup sequence is deleted or member backup is marked to be deleted
 			if countSubstring(tt.keys, path.Dir(tt.want)) <= 1 {
 				require.NoDirExists(t, path.Join(backupDir, path.Dir(tt.want)))
@@ -506,11 +523,14 @@ func TestUploadBackup(t *testing.T) {
 				require.FileExists(t, path.Join(backupDir, tt.want+".delete"))
 			}
 
-			// check if only one tar exists in the bucket
+			// check if only one tar and its checksum file exist in the bucket
 			it := bucket.List(nil)
 			obj, err := it.Next(ctx)
 			require.Nil(t, err)
-			require.Contains(t, obj.Key, path.Base(tt.want))
+			require.Equal(t, backupKey, obj.Key)
+			obj, err = it.Next(ctx)
+			require.Nil(t, err)
+			require.Equal(t, backupKey+verify.ChecksumSuffix, obj.Key)
 			_, err = it.Next(ctx)
 			require.True(t, err == io.EOF, "Error is", err)
 
@@ -525,6 +545,80 @@ func TestUploadBackup(t *testing.T) {
 			require.Nil(t, err)
 
 			require.Equal(t, str.String(), string(content))
+
+			checksum, err := bucket.ReadAll(ctx, backupKey+verify.ChecksumSuffix)
+			require.Nil(t, err)
+			sum := sha256.Sum256(content)
+			require.Equal(t, hex.EncodeToString(sum[:])+"  "+path.Base(backupKey)+"\n", string(checksum))
+		})
+	}
+}
+
+func TestTaskEvents(t *testing.T) {
+	tests := []struct {
+		name        string
+		backupKey   string
+		wantReasons []string
+	}{
+		{
+			"upload succeeded",
+			"backup-1659034855438/00000000-0000-0000-0000-000000000001",
+			[]string{k8s.ReasonUploadStarted, k8s.ReasonUploadSucceeded},
+		},
+		{
+			"upload failed",
+			"backupp-1659034855438/00000000-0000-0000-0000-000000000001",
+			[]string{k8s.ReasonUploadStarted, k8s.ReasonUploadFailed},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Set up
+			baseDir := t.TempDir()
+			err := fileutil.CreateFiles(path.Join(baseDir, DirName, tt.backupKey), exampleTarGzFiles, true)
+			require.Nil(t, err)
+			bucketPath := t.TempDir()
+
+			c := fake.NewSimpleClientset(
+				&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+					Name: "hz-0", Namespace: "ns",
+					OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "hz"}},
+				}},
+				&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+					Name: "hz", Namespace: "ns",
+					OwnerReferences: []metav1.OwnerReference{{APIVersion: "hazelcast.com/v1alpha1", Kind: "Hazelcast", Name: "hz", UID: "hz-uid"}},
+				}},
+			)
+			ctx, cancel := context.WithCancel(context.Background())
+			tsk := &task{
+				req: UploadReq{
+					BucketURL:     "file://" + bucketPath,
+					BackupBaseDir: baseDir,
+				},
+				ctx:    ctx,
+				cancel: cancel,
+				events: k8s.NewEventRecorderForClient(c, "ns", "hz-0").ForHazelcast("hz"),
+			}
+
+			// Test
+			tsk.process(stringToUUID(""))
+
+			events, err := c.CoreV1().Events("ns").List(context.Background(), metav1.ListOptions{})
+			require.Nil(t, err)
+			var podReasons, hzReasons []string
+			for _, e := range events.Items {
+				switch e.InvolvedObject.Kind {
+				case "Pod":
+					podReasons = append(podReasons, e.Reason)
+				case "Hazelcast":
+					hzReasons = append(hzReasons, e.Reason)
+				}
+				if e.Reason == k8s.ReasonUploadFailed {
+					require.Equal(t, corev1.EventTypeWarning, e.Type)
+				}
+			}
+			require.ElementsMatch(t, tt.wantReasons, podReasons)
+			require.ElementsMatch(t, tt.wantReasons, hzReasons)
 		})
 	}
 }
@@ -649,3 +743,44 @@ func countSubstring(list []string, substr string) (count int) {
 	}
 	return
 }
+
+func TestDownloadFileHandler_URLCredentials(t *testing.T) {
+	// Set up
+	t.Setenv("REPO_TOKEN", "<token>")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer <token>" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("content"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		secretName string
+		wantStatus int
+	}{
+		{"without credentials", "", http.StatusBadRequest},
+		{"with credentials", "env:repo", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := t.TempDir()
+			body, err := json.Marshal(DownloadFileReq{URL: srv.URL + "/code.jar", DestDir: dst, SecretName: tt.secretName, DownloadType: URLDownload})
+			require.Nil(t, err)
+			req := httptest.NewRequest(http.MethodPost, "/download", strings.NewReader(string(body)))
+			rec := httptest.NewRecorder()
+
+			// Run test
+			s := &Service{Tasks: map[uuid.UUID]*task{}}
+			s.downloadFileHandler(rec, req)
+			require.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusOK {
+				content, err := os.ReadFile(path.Join(dst, "code.jar"))
+				require.Nil(t, err)
+				require.Equal(t, "content", string(content))
+			}
+		})
+	}
+}